@@ -0,0 +1,131 @@
+// Package interp — встраиваемый интерпретатор оболочки: скрипты выполняются
+// с заданными потоками, окружением и рабочим каталогом, не трогая состояние процесса.
+//
+// Команды после ulimit запускаются через повторный вызов текущего бинарника, поэтому
+// программа (или TestMain) должна в самом начале вызвать shell.RunRlimitHelper.
+package interp
+
+import (
+	"15/parser"
+	"15/shell"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+type Config struct {
+	Stdin  io.Reader // по умолчанию os.Stdin
+	Stdout io.Writer // по умолчанию os.Stdout
+	Stderr io.Writer // по умолчанию os.Stderr
+
+	// Env — окружение в формате KEY=VALUE; nil — окружение процесса,
+	// пустой срез — пустое окружение
+	Env []string
+
+	// Dir — рабочий каталог; по умолчанию текущий каталог процесса
+	Dir string
+
+	// Builtins дополняют или переопределяют стандартные встроенные команды
+	Builtins map[string]shell.Builtin
+}
+
+type lockedWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+type Interpreter struct {
+	sh     *shell.Shell
+	exited bool
+}
+
+func NewInterpreter(cfg Config) (*Interpreter, error) {
+	sh := shell.New()
+	if cfg.Stdin != nil {
+		sh.Stdin = cfg.Stdin
+	}
+	if cfg.Stdout != nil {
+		sh.Stdout = cfg.Stdout
+	}
+	if cfg.Stderr != nil {
+		sh.Stderr = cfg.Stderr
+		if _, ok := cfg.Stderr.(*os.File); !ok {
+			// Stderr общий у всех команд пайплайна: exec копирует в него из нескольких горутин
+			sh.Stderr = &lockedWriter{w: cfg.Stderr}
+		}
+	}
+	if cfg.Env != nil {
+		sh.SetEnviron(cfg.Env)
+	}
+	if cfg.Dir != "" {
+		info, err := os.Stat(cfg.Dir)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			return nil, &os.PathError{Op: "chdir", Path: cfg.Dir, Err: os.ErrInvalid}
+		}
+		sh.SetDir(cfg.Dir)
+	}
+
+	sh.Builtins = parser.DefaultBuiltins()
+	for name, b := range cfg.Builtins {
+		sh.Builtins[name] = b
+	}
+	return &Interpreter{sh: sh}, nil
+}
+
+// Run выполняет скрипт построчно и возвращает код возврата последней команды
+// (или код из exit). При отмене ctx запущенные процессы завершаются.
+// Состояние оболочки сохраняется между вызовами, признак Exited — нет.
+func (in *Interpreter) Run(ctx context.Context, script string) int {
+	in.exited = false
+	for _, line := range joinFunctions(strings.Split(script, "\n")) {
+		if ctx.Err() != nil {
+			break
+		}
+		if parser.ExecuteLine(ctx, line, in.sh) {
+			in.exited = true
+			break
+		}
+	}
+	return in.sh.LastStatus
+}
+
+// Exited сообщает, была ли выполнена команда exit в последнем вызове Run.
+func (in *Interpreter) Exited() bool {
+	return in.exited
+}
+
+// Shell дает доступ к состоянию оболочки: окружению, каталогу, процессам.
+func (in *Interpreter) Shell() *shell.Shell {
+	return in.sh
+}
+
+// joinFunctions склеивает многострочные определения функций
+//
+//	name() {
+//	    cmd
+//	}
+//
+// в одну строку, которую понимает parser.ExecuteLine.
+func joinFunctions(lines []string) []string {
+	var out []string
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		for parser.Incomplete(line) && i+1 < len(lines) {
+			i++
+			line = parser.JoinLines(line, lines[i])
+		}
+		out = append(out, line)
+	}
+	return out
+}
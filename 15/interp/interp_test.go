@@ -0,0 +1,149 @@
+package interp
+
+import (
+	"15/shell"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestInterpreter(t *testing.T, cfg Config) (*Interpreter, *bytes.Buffer, *bytes.Buffer) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	cfg.Stdout, cfg.Stderr = &stdout, &stderr
+	if cfg.Stdin == nil {
+		cfg.Stdin = strings.NewReader("")
+	}
+	in, err := NewInterpreter(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return in, &stdout, &stderr
+}
+
+func TestEnv(t *testing.T) {
+	in, stdout, _ := newTestInterpreter(t, Config{Env: []string{"GREETING=hi", "PATH=" + os.Getenv("PATH")}})
+	status := in.Run(context.Background(), "echo $GREETING ${GREETING}!\nNAME=x; export OTHER=y\necho $NAME$OTHER $HOME.")
+	if status != 0 {
+		t.Fatalf("status = %d", status)
+	}
+	if got, want := stdout.String(), "hi hi!\nxy .\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	if _, ok := in.Shell().LookupEnv("HOME"); ok {
+		t.Error("process environment leaked into the interpreter")
+	}
+	if os.Getenv("NAME") != "" {
+		t.Error("assignment changed the process environment")
+	}
+}
+
+func TestDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	in, stdout, _ := newTestInterpreter(t, Config{Dir: dir})
+	in.Run(context.Background(), "pwd; cd sub; pwd; ls")
+	if got, want := stdout.String(), dir+"\n"+filepath.Join(dir, "sub")+"\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	if now, _ := os.Getwd(); now != wd {
+		t.Errorf("process directory changed to %s", now)
+	}
+
+	if _, err := NewInterpreter(Config{Dir: filepath.Join(dir, "missing")}); err == nil {
+		t.Error("missing directory accepted")
+	}
+}
+
+func TestStdin(t *testing.T) {
+	in, stdout, _ := newTestInterpreter(t, Config{Stdin: strings.NewReader("b\na\n")})
+	if status := in.Run(context.Background(), "sort | cat"); status != 0 {
+		t.Fatalf("status = %d", status)
+	}
+	if got := stdout.String(); got != "a\nb\n" {
+		t.Errorf("stdout = %q", got)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	in, stdout, stderr := newTestInterpreter(t, Config{})
+	ctx := context.Background()
+
+	if status := in.Run(ctx, "false"); status != 1 || in.Exited() {
+		t.Errorf("false: status = %d, exited = %v", status, in.Exited())
+	}
+	if status := in.Run(ctx, "no-such-command-xyz"); status != 127 {
+		t.Errorf("missing command: status = %d", status)
+	}
+	if !strings.Contains(stderr.String(), "no-such-command-xyz: command not found") {
+		t.Errorf("stderr = %q", stderr.String())
+	}
+
+	if status := in.Run(ctx, "echo before\nexit 3\necho after"); status != 3 || !in.Exited() {
+		t.Errorf("exit 3: status = %d, exited = %v", status, in.Exited())
+	}
+	// После exit интерпретатор можно использовать снова
+	if status := in.Run(ctx, "echo again"); status != 0 || in.Exited() {
+		t.Errorf("run after exit: status = %d, exited = %v", status, in.Exited())
+	}
+	if got := stdout.String(); got != "before\nagain\n" {
+		t.Errorf("stdout = %q", got)
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	var called []string
+	hello := func(ctx context.Context, sh *shell.Shell, args []string, stdin io.Reader, stdout io.Writer) error {
+		called = append(called, args...)
+		return nil
+	}
+	in, _, _ := newTestInterpreter(t, Config{Builtins: map[string]shell.Builtin{"hello": hello}})
+	if status := in.Run(context.Background(), "hello a b | cat"); status != 0 {
+		t.Fatalf("status = %d", status)
+	}
+	if strings.Join(called, " ") != "a b" {
+		t.Errorf("builtin called with %v", called)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	in, stdout, _ := newTestInterpreter(t, Config{})
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	status := in.Run(ctx, "sleep 10\necho not reached")
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run returned after %v", elapsed)
+	}
+	if status == 0 {
+		t.Error("cancelled command reported success")
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("script continued after cancel: %q", stdout.String())
+	}
+}
+
+func TestMultilineFunction(t *testing.T) {
+	in, stdout, _ := newTestInterpreter(t, Config{})
+	script := `# комментарий
+twice() {
+	echo $1
+	echo $1 # снова
+}; twice a
+twice b`
+	if status := in.Run(context.Background(), script); status != 0 {
+		t.Fatalf("status = %d", status)
+	}
+	if got := stdout.String(); got != "a\na\nb\nb\n" {
+		t.Errorf("stdout = %q", got)
+	}
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"15/interp"
 	"15/parser"
 	"15/shell"
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"os/signal"
@@ -12,7 +14,15 @@ import (
 )
 
 func main() {
-	shell := &shell.Shell{}
+	// Служебный запуск для ulimit: выставить лимиты и выполнить команду
+	shell.RunRlimitHelper()
+
+	in, err := interp.NewInterpreter(interp.Config{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	shell := in.Shell()
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT)
@@ -28,6 +38,7 @@ func main() {
 		}
 	}()
 
+	ctx := context.Background()
 	sc := bufio.NewScanner(os.Stdin)
 	for {
 		fmt.Print("$ ")
@@ -41,30 +52,19 @@ func main() {
 		if input == "" {
 			continue
 		}
-
-		commandStrings := strings.Split(input, "|")
-		var commands []*parser.Command
-		for _, cmdStr := range commandStrings {
-			cmd := parser.ParseCommand(cmdStr)
-			if cmd != nil {
-				commands = append(commands, cmd)
+		// Определение функции на несколько строк: дочитываем до закрывающей "}"
+		for parser.Incomplete(input) {
+			fmt.Print("> ")
+			if !sc.Scan() {
+				break
 			}
+			input = parser.JoinLines(input, sc.Text())
 		}
-		if len(commands) == 1 {
-			cmd := commands[0]
 
-			if cmd.Input == nil {
-				cmd.Input = os.Stdin
-			}
-			if cmd.Output == nil {
-				cmd.Output = os.Stdout
-			}
-			err := parser.ExecuteCommand(cmd, shell)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			}
-		} else {
-			parser.ExecutePipeline(commands, shell)
+		in.Run(ctx, input)
+		if in.Exited() {
+			shell.KillAllProcesses()
+			os.Exit(shell.LastStatus)
 		}
 	}
 }
@@ -0,0 +1,255 @@
+package parser
+
+import (
+	"15/service"
+	"15/shell"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Код возврата timeout при истечении времени, как в coreutils
+const timeoutStatus = 124
+
+// DefaultBuiltins возвращает стандартный набор встроенных команд.
+func DefaultBuiltins() map[string]shell.Builtin {
+	return map[string]shell.Builtin{
+		"cd":      builtinCd,
+		"pwd":     builtinPwd,
+		"echo":    builtinEcho,
+		"kill":    builtinKill,
+		"ps":      builtinPs,
+		"export":  builtinExport,
+		"unset":   builtinUnset,
+		"exit":    builtinExit,
+		"ulimit":  builtinUlimit,
+		"timeout": builtinTimeout,
+		"hash":    builtinHash,
+		"set":     builtinSet,
+	}
+}
+
+func builtinCd(ctx context.Context, sh *shell.Shell, args []string, stdin io.Reader, stdout io.Writer) error {
+	target := sh.Getenv("HOME")
+	if len(args) > 0 {
+		target = args[0]
+	}
+	if target == "" {
+		return errors.New("cd: HOME not set")
+	}
+	dir, err := service.Cd(sh.Dir(), target)
+	if err != nil {
+		return err
+	}
+	sh.SetDir(dir)
+	sh.Setenv("PWD", dir)
+	return nil
+}
+
+func builtinPwd(ctx context.Context, sh *shell.Shell, args []string, stdin io.Reader, stdout io.Writer) error {
+	return service.Pwd(sh.Dir(), stdout)
+}
+
+func builtinEcho(ctx context.Context, sh *shell.Shell, args []string, stdin io.Reader, stdout io.Writer) error {
+	return service.Echo(args, stdout)
+}
+
+func builtinKill(ctx context.Context, sh *shell.Shell, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("kill: usage: kill pid")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return err
+	}
+	return service.Kill(id)
+}
+
+func builtinPs(ctx context.Context, sh *shell.Shell, args []string, stdin io.Reader, stdout io.Writer) error {
+	return service.Ps(stdout)
+}
+
+func builtinExport(ctx context.Context, sh *shell.Shell, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		for _, kv := range sh.Environ() {
+			fmt.Fprintln(stdout, "export", kv)
+		}
+		return nil
+	}
+	for _, arg := range args {
+		// export NAME без значения — переменная уже в окружении, все переменные экспортируемые
+		if k, v, ok := strings.Cut(arg, "="); ok {
+			sh.Setenv(k, v)
+		}
+	}
+	return nil
+}
+
+// unset [-f] name...
+func builtinUnset(ctx context.Context, sh *shell.Shell, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) > 0 && args[0] == "-f" {
+		for _, arg := range args[1:] {
+			sh.UnsetFunction(arg)
+		}
+		return nil
+	}
+	for _, arg := range args {
+		sh.Unsetenv(arg)
+	}
+	return nil
+}
+
+func builtinExit(ctx context.Context, sh *shell.Shell, args []string, stdin io.Reader, stdout io.Writer) error {
+	code := sh.LastStatus
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil {
+			return &shell.StatusError{Code: 2, Err: fmt.Errorf("exit: %s: numeric argument required", args[0])}
+		}
+		code = n & 0xff
+	}
+	return &shell.ExitRequest{Code: code}
+}
+
+// ulimit [-a] | ulimit -t|-v|-n|-u [value|unlimited]
+func builtinUlimit(ctx context.Context, sh *shell.Shell, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 || args[0] == "-a" {
+		for _, r := range shell.Resources() {
+			v, err := sh.Limit(r.Flag)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%-28s(-%c) %s\n", r.Name, r.Flag, formatLimit(v))
+		}
+		return nil
+	}
+
+	flag := args[0]
+	if len(flag) != 2 || flag[0] != '-' {
+		return &shell.StatusError{Code: 2, Err: fmt.Errorf("ulimit: %s: invalid option", flag)}
+	}
+	if len(args) == 1 {
+		v, err := sh.Limit(flag[1])
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(stdout, formatLimit(v))
+		return err
+	}
+
+	value := shell.RlimInfinity
+	if args[1] != "unlimited" {
+		n, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("ulimit: %s: invalid number", args[1])
+		}
+		value = n
+	}
+	return sh.SetLimit(flag[1], value)
+}
+
+func formatLimit(v uint64) string {
+	if v == shell.RlimInfinity {
+		return "unlimited"
+	}
+	return strconv.FormatUint(v, 10)
+}
+
+// timeout DURATION command [args]: по истечении времени команде отправляется SIGTERM,
+// через KillTimeout — SIGKILL; код возврата 124.
+func builtinTimeout(ctx context.Context, sh *shell.Shell, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) < 2 {
+		return &shell.StatusError{Code: 125, Err: errors.New("timeout: usage: timeout DURATION command [args]")}
+	}
+	d, err := parseTimeout(args[0])
+	if err != nil {
+		return &shell.StatusError{Code: 125, Err: err}
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+
+	cmd := &Command{Name: args[1], Args: args[2:], Input: stdin, Output: stdout}
+	err = ExecuteCommand(tctx, cmd, sh)
+	if errors.Is(tctx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+		return &shell.StatusError{Code: timeoutStatus}
+	}
+	return err
+}
+
+// parseTimeout принимает секунды ("1.5") или длительность в формате Go ("500ms", "2m").
+func parseTimeout(s string) (time.Duration, error) {
+	if secs, err := strconv.ParseFloat(s, 64); err == nil && secs >= 0 {
+		return time.Duration(secs * float64(time.Second)), nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("timeout: invalid time interval %q", s)
+	}
+	return d, nil
+}
+
+// hash [-r] [name...]: без аргументов печатает кэш путей, -r очищает его,
+// имена ищутся заново и добавляются в кэш.
+func builtinHash(ctx context.Context, sh *shell.Shell, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) > 0 && args[0] == "-r" {
+		sh.ResetHash()
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		entries := sh.HashEntries()
+		if len(entries) == 0 {
+			_, err := fmt.Fprintln(stdout, "hash: hash table empty")
+			return err
+		}
+		fmt.Fprintln(stdout, "hits\tcommand")
+		for _, e := range entries {
+			fmt.Fprintf(stdout, "%4d\t%s\n", e.Hits, e.Path)
+		}
+		return nil
+	}
+
+	var failed error
+	for _, name := range args {
+		if err := sh.Rehash(name); err != nil {
+			failed = &shell.StatusError{Code: 1, Err: fmt.Errorf("hash: %v", err)}
+		}
+	}
+	return failed
+}
+
+// set [-x|+x] [-o|+o option] [-- args...]
+func builtinSet(ctx context.Context, sh *shell.Shell, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		for _, kv := range sh.Environ() {
+			fmt.Fprintln(stdout, kv)
+		}
+		return nil
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "-x", "+x":
+			sh.SetOption("xtrace", arg == "-x")
+		case "-o", "+o":
+			if i+1 >= len(args) {
+				return &shell.StatusError{Code: 2, Err: fmt.Errorf("set: %s: option name required", arg)}
+			}
+			i++
+			if args[i] != "xtrace" {
+				return &shell.StatusError{Code: 2, Err: fmt.Errorf("set: %s: invalid option name", args[i])}
+			}
+			sh.SetOption(args[i], arg == "-o")
+		case "--":
+			sh.SetParams(args[i+1:])
+			return nil
+		default:
+			return &shell.StatusError{Code: 2, Err: fmt.Errorf("set: %s: invalid option", arg)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"15/shell"
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+)
+
+// Имя функции-обработчика ненайденных команд, как в bash
+const commandNotFoundHandler = "command_not_found_handle"
+
+// name() { body } — тело может быть пустым или незакрытым (многострочное определение)
+var funcDefRe = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)\s*\(\)\s*\{(.*)$`)
+
+type inHandlerKey struct{}
+
+// ParseFunction разбирает определение "name() { cmd1; cmd2; }" в начале строки.
+// rest — команды после закрывающей "}"; complete == false, если "}" еще не встретилась.
+func ParseFunction(line string) (name, body, rest string, complete, ok bool) {
+	m := funcDefRe.FindStringSubmatch(strings.TrimSpace(line))
+	if m == nil {
+		return "", "", "", false, false
+	}
+	text := m[2]
+	end := closingBrace(text)
+	if end < 0 {
+		return m[1], strings.TrimSpace(text), "", false, true
+	}
+	body = strings.TrimSpace(text[:end])
+	rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(text[end+1:]), ";"))
+	return m[1], strings.TrimSuffix(body, ";"), rest, true, true
+}
+
+// closingBrace ищет "}" отдельным словом: после пробела или ";" и перед пробелом, ";" или
+// концом строки. "}" из ${NAME} так не выглядит.
+func closingBrace(s string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] != '}' {
+			continue
+		}
+		if (i == 0 || isSeparator(s[i-1])) && (i+1 == len(s) || isSeparator(s[i+1])) {
+			return i
+		}
+	}
+	return -1
+}
+
+func isSeparator(c byte) bool {
+	return c == ' ' || c == '\t' || c == ';'
+}
+
+// Incomplete сообщает, что в строке есть незакрытое определение функции
+// и ее нужно продолжить следующими строками (см. JoinLines).
+func Incomplete(line string) bool {
+	line = stripComment(line)
+	for line != "" {
+		_, _, rest, complete, ok := ParseFunction(line)
+		if ok {
+			if !complete {
+				return true
+			}
+			line = rest
+			continue
+		}
+		_, line, _ = strings.Cut(line, ";")
+	}
+	return false
+}
+
+// JoinLines дописывает к незакрытому определению функции следующую строку скрипта:
+// перевод строки в теле функции разделяет команды, как ";".
+func JoinLines(line, next string) string {
+	next = strings.TrimSpace(stripComment(next))
+	if next == "" {
+		return line
+	}
+	line = strings.TrimRight(stripComment(line), " \t")
+	if strings.HasSuffix(line, "{") || strings.HasSuffix(line, ";") {
+		return line + " " + next
+	}
+	return line + "; " + next
+}
+
+// callFunction выполняет тело функции с аргументами команды в качестве $1, $2, ...
+// Код возврата функции — код последней выполненной в ней команды.
+func callFunction(ctx context.Context, body string, cmd *Command, sh *shell.Shell) error {
+	saved := sh.Params()
+	sh.SetParams(cmd.Args)
+	defer sh.SetParams(saved)
+
+	if executeLine(ctx, body, sh, cmd.Input, cmd.Output) {
+		return &shell.ExitRequest{Code: sh.LastStatus}
+	}
+	if sh.LastStatus != 0 {
+		return &shell.StatusError{Code: sh.LastStatus}
+	}
+	return nil
+}
+
+// commandNotFound вызывает command_not_found_handle с именем и аргументами команды,
+// если функция определена; иначе возвращает исходную ошибку поиска (код 127/126).
+func commandNotFound(ctx context.Context, cmd *Command, sh *shell.Shell, err error) error {
+	var se *shell.StatusError
+	if !errors.As(err, &se) || se.Code != 127 {
+		return err
+	}
+	// Внутри обработчика повторно его не вызываем, чтобы не уйти в рекурсию
+	if ctx.Value(inHandlerKey{}) != nil {
+		return err
+	}
+	body, ok := sh.Function(commandNotFoundHandler)
+	if !ok {
+		return err
+	}
+	ctx = context.WithValue(ctx, inHandlerKey{}, true)
+	handlerCmd := &Command{
+		Name:   commandNotFoundHandler,
+		Args:   append([]string{cmd.Name}, cmd.Args...),
+		Input:  cmd.Input,
+		Output: cmd.Output,
+	}
+	return callFunction(ctx, body, handlerCmd, sh)
+}
@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"15/shell"
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+// newTestShell — оболочка со стандартными встроенными командами и выводом в буферы.
+func newTestShell() (*shell.Shell, *bytes.Buffer, *bytes.Buffer) {
+	var stdout, stderr bytes.Buffer
+	sh := shell.New()
+	sh.Stdin = strings.NewReader("")
+	sh.Stdout, sh.Stderr = &stdout, &stderr
+	sh.Builtins = DefaultBuiltins()
+	return sh, &stdout, &stderr
+}
+
+func TestParseFunction(t *testing.T) {
+	tests := []struct {
+		line             string
+		name, body, rest string
+		complete, ok     bool
+	}{
+		{"f() { echo a; }", "f", "echo a", "", true, true},
+		{"f () {echo a; echo b;}", "f", "echo a; echo b", "", true, true},
+		{"f() { echo a; echo b; }", "f", "echo a; echo b", "", true, true},
+		{"f() { echo a; }; f x", "f", "echo a", "f x", true, true},
+		{"f() { echo ${X}; }", "f", "echo ${X}", "", true, true},
+		{"f() { }", "f", "", "", true, true},
+		{"f() {", "f", "", "", false, true},
+		{"f() { echo a", "f", "echo a", "", false, true},
+		{"echo f() {", "", "", "", false, false},
+	}
+	for _, tt := range tests {
+		name, body, rest, complete, ok := ParseFunction(tt.line)
+		if name != tt.name || body != tt.body || rest != tt.rest || complete != tt.complete || ok != tt.ok {
+			t.Errorf("ParseFunction(%q) = %q, %q, %q, %v, %v", tt.line, name, body, rest, complete, ok)
+		}
+	}
+}
+
+func TestJoinLines(t *testing.T) {
+	lines := []string{"f() {", "  echo a  # comment", "", "  echo b;", "}; f"}
+	line := lines[0]
+	for _, next := range lines[1:] {
+		if !Incomplete(line) {
+			t.Fatalf("%q reported complete", line)
+		}
+		line = JoinLines(line, next)
+	}
+	if Incomplete(line) {
+		t.Errorf("%q reported incomplete", line)
+	}
+	if want := "f() { echo a; echo b; }; f"; line != want {
+		t.Errorf("joined = %q, want %q", line, want)
+	}
+	if Incomplete("echo a; echo b") || !Incomplete("echo a; g() { echo b") {
+		t.Error("Incomplete misreports plain commands")
+	}
+}
+
+func TestFunctions(t *testing.T) {
+	sh, stdout, stderr := newTestShell()
+	ctx := context.Background()
+	lines := []string{
+		"greet() { echo hello $1 from $#: $@; }; greet a b",
+		"outer() { greet inner; echo back $1; }",
+		"outer x",
+		"set -- p1 p2; echo $1 $#",
+		"fail() { echo before; false; }; fail; echo status $?",
+		"unset -f greet; greet",
+	}
+	for _, l := range lines {
+		if ExecuteLine(ctx, l, sh) {
+			t.Fatalf("%q requested exit", l)
+		}
+	}
+	want := "hello a from 2: a b\nhello inner from 1: inner\nback x\np1 2\nbefore\nstatus 1\n"
+	if got := stdout.String(); got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	if sh.LastStatus != 127 || !strings.Contains(stderr.String(), "greet: command not found") {
+		t.Errorf("after unset -f: status %d, stderr %q", sh.LastStatus, stderr.String())
+	}
+
+	ExecuteLine(ctx, "broken() { echo a", sh)
+	if sh.LastStatus != 2 || !strings.Contains(stderr.String(), "missing '}'") {
+		t.Errorf("unterminated definition: status %d, stderr %q", sh.LastStatus, stderr.String())
+	}
+
+	if !ExecuteLine(ctx, "quit() { exit 4; echo no; }; quit; echo no", sh) || sh.LastStatus != 4 {
+		t.Errorf("exit in function: status %d", sh.LastStatus)
+	}
+}
+
+func TestCommandNotFoundHandler(t *testing.T) {
+	sh, stdout, stderr := newTestShell()
+	ctx := context.Background()
+	ExecuteLine(ctx, "command_not_found_handle() { echo missing $1 args $2; nosuchcmd2; }", sh)
+	ExecuteLine(ctx, "nosuchcmd1 x", sh)
+	if got := stdout.String(); got != "missing nosuchcmd1 args x\n" {
+		t.Errorf("stdout = %q", got)
+	}
+	// Внутри обработчика он повторно не вызывается
+	if sh.LastStatus != 127 || !strings.Contains(stderr.String(), "nosuchcmd2: command not found") {
+		t.Errorf("status %d, stderr %q", sh.LastStatus, stderr.String())
+	}
+}
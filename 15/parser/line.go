@@ -0,0 +1,162 @@
+package parser
+
+import (
+	"15/shell"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	assignmentRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+	varRe        = regexp.MustCompile(`\$(?:[?#@*1-9]|[A-Za-z_][A-Za-z0-9_]*|\{[A-Za-z_][A-Za-z0-9_]*\})`)
+)
+
+// ExecuteLine выполняет строку скрипта: команды через ";", пайплайны, time, присваивания NAME=value
+// и определения функций name() { ...; }.
+// Код последней команды сохраняется в LastStatus. Возвращает true, если была выполнена exit.
+func ExecuteLine(ctx context.Context, line string, sh *shell.Shell) bool {
+	return executeLine(ctx, line, sh, sh.Stdin, sh.Stdout)
+}
+
+// executeLine — ExecuteLine с заданными потоками на концах пайплайнов (нужно для тела функции).
+func executeLine(ctx context.Context, line string, sh *shell.Shell, stdin io.Reader, stdout io.Writer) bool {
+	line = stripComment(line)
+	for line != "" {
+		if name, body, rest, complete, ok := ParseFunction(line); ok {
+			if !complete {
+				reportError(sh, &shell.StatusError{Code: 2, Err: fmt.Errorf("%s: syntax error: missing '}'", name)})
+				sh.LastStatus = 2
+				return false
+			}
+			sh.DefineFunction(name, body)
+			sh.LastStatus = 0
+			line = rest
+			continue
+		}
+
+		var segment string
+		segment, line, _ = strings.Cut(line, ";")
+		segment = strings.TrimSpace(segment)
+		if segment == "" {
+			continue
+		}
+		if ctx.Err() != nil {
+			return false
+		}
+
+		posix, pipeline, timed := ParseTime(segment)
+		commands := ParsePipeline(pipeline)
+		for _, cmd := range commands {
+			ExpandCommand(cmd, sh)
+		}
+
+		for _, cmd := range commands {
+			traceCommand(sh, cmd)
+		}
+
+		if !timed && len(commands) == 1 && len(commands[0].Args) == 0 && assignmentRe.MatchString(commands[0].Name) {
+			k, v, _ := strings.Cut(commands[0].Name, "=")
+			sh.Setenv(k, v)
+			sh.LastStatus = 0
+			continue
+		}
+
+		if len(commands) > 0 {
+			commands[0].Input = stdin
+			commands[len(commands)-1].Output = stdout
+		}
+
+		var err error
+		if timed {
+			err = ExecuteTimed(ctx, commands, sh, TimeFormat(sh, posix), sh.Stderr)
+		} else {
+			err = ExecutePipeline(ctx, commands, sh)
+		}
+
+		var exitReq *shell.ExitRequest
+		if errors.As(err, &exitReq) {
+			sh.LastStatus = exitReq.Code
+			return true
+		}
+		reportError(sh, err)
+		sh.LastStatus = shell.ExitStatus(err)
+	}
+	return false
+}
+
+// ExpandCommand раскрывает $NAME, ${NAME}, $?, позиционные параметры $1..$9, $# и $@
+// в имени и аргументах команды. Отдельное слово $@ раскрывается в несколько аргументов.
+func ExpandCommand(cmd *Command, sh *shell.Shell) {
+	cmd.Name = expandWord(cmd.Name, sh)
+	args := make([]string, 0, len(cmd.Args))
+	for _, arg := range cmd.Args {
+		if arg == "$@" {
+			args = append(args, sh.Params()...)
+			continue
+		}
+		args = append(args, expandWord(arg, sh))
+	}
+	cmd.Args = args
+}
+
+func expandWord(word string, sh *shell.Shell) string {
+	if !strings.Contains(word, "$") {
+		return word
+	}
+	return varRe.ReplaceAllStringFunc(word, func(m string) string {
+		name := strings.Trim(m[1:], "{}")
+		switch name {
+		case "?":
+			return strconv.Itoa(sh.LastStatus)
+		case "#":
+			return strconv.Itoa(len(sh.Params()))
+		case "@", "*":
+			return strings.Join(sh.Params(), " ")
+		}
+		if n, err := strconv.Atoi(name); err == nil {
+			params := sh.Params()
+			if n > len(params) {
+				return ""
+			}
+			return params[n-1]
+		}
+		return sh.Getenv(name)
+	})
+}
+
+// stripComment отбрасывает комментарий, начинающийся с "#" в начале слова.
+func stripComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		if line[i] == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t') {
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// reportError печатает ошибку в stderr оболочки. Ненулевой код завершения
+// процесса ошибкой не считается — он доступен через $?. Ошибки с кодом
+// (command not found и т.п.) печатаются в стиле sh, без префикса.
+func reportError(sh *shell.Shell, err error) {
+	if err == nil {
+		return
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		return
+	}
+	var se *shell.StatusError
+	if errors.As(err, &se) {
+		if se.Err != nil {
+			fmt.Fprintf(sh.Stderr, "%v\n", se.Err)
+		}
+		return
+	}
+	fmt.Fprintf(sh.Stderr, "Error: %v\n", err)
+}
@@ -1,14 +1,14 @@
 package parser
 
 import (
-	"15/service"
 	"15/shell"
+	"context"
 	"io"
-	"os"
 	"os/exec"
-	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 )
 
 type Command struct {
@@ -19,7 +19,9 @@ type Command struct {
 	Cmd    *exec.Cmd
 }
 
-func ExecutePipeline(commands []*Command, shell *shell.Shell) error {
+// ExecutePipeline запускает команды пайплайна параллельно и возвращает ошибку
+// последней команды — ее код и становится кодом пайплайна.
+func ExecutePipeline(ctx context.Context, commands []*Command, shell *shell.Shell) error {
 	if len(commands) == 0 {
 		return nil
 	}
@@ -35,15 +37,15 @@ func ExecutePipeline(commands []*Command, shell *shell.Shell) error {
 
 	// Устанавливаем граничные потоки
 	if commands[0].Input == nil {
-		commands[0].Input = os.Stdin
+		commands[0].Input = shell.Stdin
 	}
 	if commands[len(commands)-1].Output == nil {
-		commands[len(commands)-1].Output = os.Stdout
+		commands[len(commands)-1].Output = shell.Stdout
 	}
 
 	// Запускаем команды
 	var wg sync.WaitGroup
-	errCh := make(chan error, len(commands))
+	errs := make([]error, len(commands))
 
 	for i, cmd := range commands {
 		wg.Add(1)
@@ -56,42 +58,57 @@ func ExecutePipeline(commands []*Command, shell *shell.Shell) error {
 					defer writer.Close()
 				}
 			}
-
-			err := ExecuteCommand(cmd, shell)
-			if err != nil {
-				errCh <- err
+			// Закрываем чтение, чтобы пишущая команда не зависла, если эта завершилась раньше
+			if reader, ok := cmd.Input.(*io.PipeReader); ok {
+				defer reader.Close()
 			}
+
+			errs[i] = ExecuteCommand(ctx, cmd, shell)
 		}(i, cmd)
 	}
 
 	wg.Wait()
-	close(errCh)
 
-	// Вернуть первую ошибку
-	for err := range errCh {
-		return err
-	}
-	return nil
+	return errs[len(errs)-1]
 }
 
-func ExecuteCommand(cmd *Command, shell *shell.Shell) error {
-	if isBuiltin(cmd.Name) {
-		return ExecuteBuiltin(cmd)
+func ExecuteCommand(ctx context.Context, cmd *Command, shell *shell.Shell) error {
+	if cmd.Input == nil {
+		cmd.Input = shell.Stdin
+	}
+	if cmd.Output == nil {
+		cmd.Output = shell.Stdout
 	}
-	return ExecuteExternal(cmd, shell)
+	if !shell.AuditEnabled() {
+		_, err := executeCommand(ctx, cmd, shell)
+		return err
+	}
+
+	start := time.Now()
+	cwd := shell.Dir()
+	kind, err := executeCommand(ctx, cmd, shell)
+	auditCommand(shell, cmd, kind, cwd, start, err)
+	return err
 }
 
-func isBuiltin(name string) bool {
-	return name == "cd" || name == "pwd" || name == "echo" || name == "kill" || name == "ps"
+// executeCommand выполняет команду и возвращает ее вид для журнала аудита.
+func executeCommand(ctx context.Context, cmd *Command, shell *shell.Shell) (string, error) {
+	// Как в bash: функции, затем встроенные команды, затем внешние
+	if body, ok := shell.Function(cmd.Name); ok {
+		return "function", callFunction(ctx, body, cmd, shell)
+	}
+	if builtin, ok := shell.Builtins[cmd.Name]; ok {
+		return "builtin", builtin(ctx, shell, cmd.Args, cmd.Input, cmd.Output)
+	}
+	return "external", ExecuteExternal(ctx, cmd, shell)
 }
 
 func ParseCommand(line string) *Command {
-	if line == "" {
+	parts := strings.Fields(line)
+	if len(parts) == 0 {
 		return nil
 	}
 
-	parts := strings.Fields(line)
-
 	cmd := &Command{
 		Name: parts[0],
 		Args: parts[1:],
@@ -100,45 +117,52 @@ func ParseCommand(line string) *Command {
 
 }
 
-func ExecuteBuiltin(cmd *Command) error {
-	switch cmd.Name {
-	case "cd":
-		return service.Cd(cmd.Args[0])
-	case "pwd":
-		return service.Pwd(cmd.Output)
-	case "echo":
-		return service.Echo(cmd.Args, cmd.Output)
-	case "kill":
-		id, err := strconv.Atoi(cmd.Args[0])
-		if err != nil {
-			return err
+// ParsePipeline разбивает строку по "|" на команды.
+func ParsePipeline(line string) []*Command {
+	var commands []*Command
+	for _, cmdStr := range strings.Split(line, "|") {
+		cmd := ParseCommand(cmdStr)
+		if cmd != nil {
+			commands = append(commands, cmd)
 		}
-		return service.Kill(id)
-	case "ps":
-		return service.Ps(cmd.Output)
-	default:
-		return nil
 	}
+	return commands
 }
 
-func ExecuteExternal(cmd *Command, shell *shell.Shell) error {
-	c := exec.Command(cmd.Name, cmd.Args...)
-	if cmd.Input != nil {
-		c.Stdin = cmd.Input
-	} else {
-		c.Stdin = os.Stdin
+func ExecuteExternal(ctx context.Context, cmd *Command, sh *shell.Shell) error {
+	path, err := sh.LookPath(cmd.Name)
+	if err != nil {
+		return commandNotFound(ctx, cmd, sh, err)
+	}
+	name, args, err := sh.LimitedCommand(path, cmd.Args)
+	if err != nil {
+		return err
+	}
+	c := exec.CommandContext(ctx, name, args...)
+	if name == path {
+		// argv[0] — имя, как его набрал пользователь
+		c.Args[0] = cmd.Name
 	}
-	if cmd.Output != nil {
-		c.Stdout = cmd.Output
-	} else {
-		c.Stdout = os.Stdout
+	// При отмене контекста — SIGTERM, через KillTimeout SIGKILL, как в KillAllProcesses
+	c.Cancel = func() error {
+		return c.Process.Signal(syscall.SIGTERM)
 	}
+	c.WaitDelay = shell.KillTimeout
+
+	c.Dir = sh.Dir()
+	c.Env = sh.Environ()
+	c.Stdin = cmd.Input
+	c.Stdout = cmd.Output
+	c.Stderr = sh.Stderr
+	cmd.Cmd = c
 
-	c.Stderr = os.Stderr
-	shell.AddProcess(c)
+	if err := c.Start(); err != nil {
+		return err
+	}
+	sh.AddProcess(c)
 
-	err := c.Run()
-	shell.RemoveProcess(c)
+	err = c.Wait()
+	sh.RemoveProcess(c)
 
 	return err
 }
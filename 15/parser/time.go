@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"15/shell"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Формат по умолчанию, как в bash, плюс пиковое потребление памяти
+const defaultTimeFormat = "\nreal\t%3lR\nuser\t%3lU\nsys\t%3lS\nmaxrss\t%MKB"
+
+// Формат для time -p (POSIX)
+const posixTimeFormat = "real %2R\nuser %2U\nsys %2S"
+
+type TimeStats struct {
+	Real   time.Duration
+	User   time.Duration
+	Sys    time.Duration
+	MaxRSS int64 // в килобайтах
+}
+
+// ExecuteTimed выполняет пайплайн и печатает затраченное время в output.
+// User и sys суммируются по всем внешним процессам пайплайна, maxrss — максимум среди них.
+func ExecuteTimed(ctx context.Context, commands []*Command, shell *shell.Shell, format string, output io.Writer) error {
+	start := time.Now()
+	err := ExecutePipeline(ctx, commands, shell)
+	stats := TimeStats{Real: time.Since(start)}
+
+	for _, cmd := range commands {
+		if cmd.Cmd == nil || cmd.Cmd.ProcessState == nil {
+			continue
+		}
+		user, sys, maxRSS, ok := processUsage(cmd.Cmd.ProcessState)
+		if !ok {
+			continue
+		}
+		stats.User += user
+		stats.Sys += sys
+		stats.MaxRSS = max(stats.MaxRSS, maxRSS)
+	}
+
+	fmt.Fprintln(output, FormatTime(format, stats))
+	return err
+}
+
+// ParseTime разбирает "time [-p] pipeline" и возвращает сам пайплайн.
+func ParseTime(input string) (posix bool, pipeline string, ok bool) {
+	if input != "time" && !strings.HasPrefix(input, "time ") {
+		return false, input, false
+	}
+	rest := strings.TrimSpace(strings.TrimPrefix(input, "time"))
+	if rest == "-p" || strings.HasPrefix(rest, "-p ") {
+		posix = true
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, "-p"))
+	}
+	return posix, rest, true
+}
+
+// TimeFormat возвращает формат вывода time: для -p — POSIX,
+// иначе TIMEFORMAT из окружения оболочки или формат по умолчанию.
+func TimeFormat(shell *shell.Shell, posix bool) string {
+	if posix {
+		return posixTimeFormat
+	}
+	if format, ok := shell.LookupEnv("TIMEFORMAT"); ok {
+		return format
+	}
+	return defaultTimeFormat
+}
+
+// FormatTime подставляет значения в формат TIMEFORMAT.
+// Поддерживаются %[p][l]R, %[p][l]U, %[p][l]S (p — число знаков после запятой, 0-3),
+// %P (процент CPU), %M (maxrss в КБ) и %%. Последовательности \n и \t раскрываются.
+func FormatTime(format string, st TimeStats) string {
+	format = strings.NewReplacer(`\n`, "\n", `\t`, "\t").Replace(format)
+
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		ch := format[i]
+		if ch != '%' || i+1 >= len(format) {
+			b.WriteByte(ch)
+			continue
+		}
+
+		j := i + 1
+		precision := 3
+		if format[j] >= '0' && format[j] <= '9' {
+			precision = min(int(format[j]-'0'), 3)
+			j++
+		}
+		long := false
+		if j < len(format) && format[j] == 'l' {
+			long = true
+			j++
+		}
+		if j >= len(format) {
+			b.WriteString(format[i:])
+			break
+		}
+
+		switch format[j] {
+		case 'R':
+			b.WriteString(formatDuration(st.Real, precision, long))
+		case 'U':
+			b.WriteString(formatDuration(st.User, precision, long))
+		case 'S':
+			b.WriteString(formatDuration(st.Sys, precision, long))
+		case 'P':
+			var pct float64
+			if st.Real > 0 {
+				pct = float64(st.User+st.Sys) / float64(st.Real) * 100
+			}
+			b.WriteString(strconv.FormatFloat(pct, 'f', 2, 64))
+		case 'M':
+			b.WriteString(strconv.FormatInt(st.MaxRSS, 10))
+		case '%':
+			b.WriteByte('%')
+		default:
+			// неизвестная директива выводится как есть
+			b.WriteString(format[i : j+1])
+		}
+		i = j
+	}
+	return b.String()
+}
+
+func formatDuration(d time.Duration, precision int, long bool) string {
+	if !long {
+		return strconv.FormatFloat(d.Seconds(), 'f', precision, 64)
+	}
+	minutes := int64(d / time.Minute)
+	seconds := (d % time.Minute).Seconds()
+	return fmt.Sprintf("%dm%ss", minutes, strconv.FormatFloat(seconds, 'f', precision, 64))
+}
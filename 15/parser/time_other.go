@@ -0,0 +1,13 @@
+//go:build !unix
+
+package parser
+
+import (
+	"os"
+	"time"
+)
+
+// processUsage: getrusage есть только в unix, time показывает лишь real.
+func processUsage(ps *os.ProcessState) (user, sys time.Duration, maxRSS int64, ok bool) {
+	return 0, 0, 0, false
+}
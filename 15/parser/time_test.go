@@ -0,0 +1,55 @@
+package parser
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		input    string
+		posix    bool
+		pipeline string
+		ok       bool
+	}{
+		{"time ls | wc -l", false, "ls | wc -l", true},
+		{"time -p sleep 1", true, "sleep 1", true},
+		{"time", false, "", true},
+		{"time -p", true, "", true},
+		{"timeout 1 ls", false, "timeout 1 ls", false},
+		{"ls", false, "ls", false},
+	}
+	for _, tt := range tests {
+		posix, pipeline, ok := ParseTime(tt.input)
+		if posix != tt.posix || pipeline != tt.pipeline || ok != tt.ok {
+			t.Errorf("ParseTime(%q) = %v, %q, %v; want %v, %q, %v",
+				tt.input, posix, pipeline, ok, tt.posix, tt.pipeline, tt.ok)
+		}
+	}
+}
+
+func TestFormatTime(t *testing.T) {
+	st := TimeStats{
+		Real:   61*time.Second + 234567*time.Microsecond,
+		User:   1500 * time.Millisecond,
+		Sys:    250 * time.Millisecond,
+		MaxRSS: 2048,
+	}
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{defaultTimeFormat, "\nreal\t1m1.235s\nuser\t0m1.500s\nsys\t0m0.250s\nmaxrss\t2048KB"},
+		{posixTimeFormat, "real 61.23\nuser 1.50\nsys 0.25"},
+		{"%R", "61.235"},
+		{"%0R %1U %9S", "61 1.5 0.250"},
+		{`%P%%\t%M`, "2.86%\t2048"},
+		{"%lX %", "%lX %"},
+		{"%l", "%l"},
+	}
+	for _, tt := range tests {
+		if got := FormatTime(tt.format, st); got != tt.want {
+			t.Errorf("FormatTime(%q) = %q, want %q", tt.format, got, tt.want)
+		}
+	}
+}
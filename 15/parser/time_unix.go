@@ -0,0 +1,25 @@
+//go:build unix
+
+package parser
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// processUsage возвращает user и sys время процесса и пиковую память в килобайтах.
+func processUsage(ps *os.ProcessState) (user, sys time.Duration, maxRSS int64, ok bool) {
+	ru, ok := ps.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return 0, 0, 0, false
+	}
+	// На 32-битных платформах поле int32
+	maxRSS = int64(ru.Maxrss)
+	// В macOS ru_maxrss в байтах, в остальных системах — в килобайтах
+	if runtime.GOOS == "darwin" || runtime.GOOS == "ios" {
+		maxRSS /= 1024
+	}
+	return time.Duration(ru.Utime.Nano()), time.Duration(ru.Stime.Nano()), maxRSS, true
+}
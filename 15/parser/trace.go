@@ -0,0 +1,48 @@
+package parser
+
+import (
+	"15/shell"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Префикс трассировки по умолчанию, как в bash
+const defaultPS4 = "+ "
+
+// traceCommand печатает раскрытую команду с префиксом PS4, если включен set -x.
+func traceCommand(sh *shell.Shell, cmd *Command) {
+	if !sh.Option("xtrace") {
+		return
+	}
+	ps4, ok := sh.LookupEnv("PS4")
+	if !ok {
+		ps4 = defaultPS4
+	}
+	words := append([]string{cmd.Name}, cmd.Args...)
+	fmt.Fprintf(sh.Stderr, "%s%s\n", expandWord(ps4, sh), strings.Join(words, " "))
+}
+
+func auditCommand(sh *shell.Shell, cmd *Command, kind, cwd string, start time.Time, err error) {
+	rec := shell.AuditRecord{
+		Time:       start,
+		Cwd:        cwd,
+		ShellPID:   os.Getpid(),
+		PID:        os.Getpid(),
+		Kind:       kind,
+		Command:    cmd.Name,
+		Args:       cmd.Args,
+		DurationMS: float64(time.Since(start).Microseconds()) / 1000,
+		ExitCode:   shell.ExitStatus(err),
+	}
+	if rec.Args == nil {
+		rec.Args = []string{}
+	}
+	if kind == "external" && cmd.Cmd != nil && cmd.Cmd.Process != nil {
+		rec.PID = cmd.Cmd.Process.Pid
+	}
+	if auditErr := sh.Audit(rec); auditErr != nil {
+		fmt.Fprintf(sh.Stderr, "audit: %v\n", auditErr)
+	}
+}
@@ -0,0 +1,111 @@
+package parser
+
+import (
+	"15/shell"
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTrace(t *testing.T) {
+	sh, stdout, stderr := newTestShell()
+	ctx := context.Background()
+	sh.Setenv("NAME", "world")
+	for _, l := range []string{
+		"echo untraced",
+		"set -x",
+		"echo hello $NAME | cat",
+	} {
+		ExecuteLine(ctx, l, sh)
+	}
+	// Кавычек оболочка не понимает, поэтому PS4 с $? задаем напрямую
+	sh.Setenv("PS4", "[$?] ")
+	for _, l := range []string{
+		"false; echo x",
+		"set +x; echo quiet",
+	} {
+		ExecuteLine(ctx, l, sh)
+	}
+	if got, want := stdout.String(), "untraced\nhello world\nx\nquiet\n"; got != want {
+		t.Errorf("stdout = %q, want %q", got, want)
+	}
+	// PS4 раскрывается перед каждой строкой трассировки: $? — код предыдущей команды
+	want := "+ echo hello world\n+ cat\n[0] false\n[1] echo x\n[0] set +x\n"
+	if got := stderr.String(); got != want {
+		t.Errorf("trace = %q, want %q", got, want)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	sh, _, _ := newTestShell()
+	ctx := context.Background()
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "audit.log")
+	sh.SetDir(dir)
+	sh.Setenv(shell.AuditLogVar, logPath)
+
+	ExecuteLine(ctx, "f() { echo in f; }; echo a b | cat; f; sh -c 'exit'; false", sh)
+
+	f, err := os.Open(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var recs []map[string]any
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var rec map[string]any
+		if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+			t.Fatalf("bad JSON line %q: %v", sc.Text(), err)
+		}
+		recs = append(recs, rec)
+	}
+
+	type summary struct {
+		Kind, Command string
+		Args          string
+		Exit          float64
+	}
+	var got []summary
+	for _, rec := range recs {
+		for _, field := range []string{"time", "cwd", "shell_pid", "pid", "kind", "command", "args", "duration_ms", "exit_code"} {
+			if _, ok := rec[field]; !ok {
+				t.Errorf("record %v has no %s", rec, field)
+			}
+		}
+		if rec["cwd"] != dir {
+			t.Errorf("cwd = %v, want %s", rec["cwd"], dir)
+		}
+		if rec["shell_pid"] != float64(os.Getpid()) {
+			t.Errorf("shell_pid = %v", rec["shell_pid"])
+		}
+		if rec["kind"] == "external" && rec["pid"] == rec["shell_pid"] {
+			t.Errorf("external command logged with the shell pid: %v", rec)
+		}
+		args, _ := json.Marshal(rec["args"])
+		got = append(got, summary{rec["kind"].(string), rec["command"].(string), string(args), rec["exit_code"].(float64)})
+	}
+	// Команды пайплайна выполняются параллельно, поэтому echo и cat могут записаться в любом порядке
+	if len(got) >= 2 && got[0].Command == "cat" {
+		got[0], got[1] = got[1], got[0]
+	}
+	want := []summary{
+		{"builtin", "echo", `["a","b"]`, 0},
+		{"external", "cat", `[]`, 0},
+		{"builtin", "echo", `["in","f"]`, 0},
+		{"function", "f", `[]`, 0},
+		{"external", "sh", `["-c","'exit'"]`, 0},
+		{"external", "false", `[]`, 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("records = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("record %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
@@ -1,13 +1,23 @@
 package service
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
 )
 
-func Cd(dir string) error {
-	err := os.Chdir(dir)
+// Cd возвращает новый текущий каталог; относительные пути считаются от cwd.
+func Cd(cwd, dir string) (string, error) {
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(cwd, dir)
+	}
+	dir = filepath.Clean(dir)
+	info, err := os.Stat(dir)
 	if err != nil {
-		return err
+		return "", err
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("cd: %s: not a directory", dir)
 	}
-	return nil
+	return dir, nil
 }
@@ -3,14 +3,9 @@ package service
 import (
 	"fmt"
 	"io"
-	"os"
 )
 
-func Pwd(output io.Writer) error {
-	pwd, err := os.Getwd()
-	if err != nil {
-		return err
-	}
-	_, err = fmt.Fprintln(output, pwd)
+func Pwd(dir string, output io.Writer) error {
+	_, err := fmt.Fprintln(output, dir)
 	return err
 }
@@ -0,0 +1,50 @@
+package shell
+
+import (
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// AuditLogVar — переменная окружения оболочки с путем к журналу аудита
+const AuditLogVar = "SHELL_AUDIT_LOG"
+
+// AuditRecord — одна строка журнала аудита (JSON lines).
+type AuditRecord struct {
+	Time       time.Time `json:"time"`
+	Cwd        string    `json:"cwd"`
+	ShellPID   int       `json:"shell_pid"`
+	PID        int       `json:"pid"`  // pid процесса, для встроенных команд — pid оболочки
+	Kind       string    `json:"kind"` // external, builtin или function
+	Command    string    `json:"command"`
+	Args       []string  `json:"args"`
+	DurationMS float64   `json:"duration_ms"`
+	ExitCode   int       `json:"exit_code"`
+}
+
+// AuditEnabled сообщает, задан ли журнал аудита.
+func (s *Shell) AuditEnabled() bool {
+	return s.Getenv(AuditLogVar) != ""
+}
+
+// Audit дописывает запись в журнал из SHELL_AUDIT_LOG. Файл открывается на добавление
+// для каждой записи, поэтому несколько оболочек могут писать в один журнал.
+func (s *Shell) Audit(rec AuditRecord) error {
+	path := s.Getenv(AuditLogVar)
+	if path == "" {
+		return nil
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,37 @@
+package shell
+
+// DefineFunction сохраняет тело функции оболочки (команды через ";").
+func (s *Shell) DefineFunction(name, body string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.functions == nil {
+		s.functions = make(map[string]string)
+	}
+	s.functions[name] = body
+}
+
+func (s *Shell) Function(name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	body, ok := s.functions[name]
+	return body, ok
+}
+
+func (s *Shell) UnsetFunction(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.functions, name)
+}
+
+// Params возвращает позиционные параметры ($1, $2, ...).
+func (s *Shell) Params() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.params
+}
+
+func (s *Shell) SetParams(params []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.params = params
+}
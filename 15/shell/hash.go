@@ -0,0 +1,149 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type hashEntry struct {
+	path string
+	hits int
+}
+
+// HashEntry — запись кэша путей для вывода hash.
+type HashEntry struct {
+	Name string
+	Path string
+	Hits int
+}
+
+// LookPath ищет исполняемый файл по PATH оболочки (а не процесса) и кэширует результат.
+// Кэш сбрасывается при изменении PATH (см. Setenv). Ошибки — StatusError с кодом 127 (не найдено)
+// или 126 (найдено, но не исполняемо).
+func (s *Shell) LookPath(name string) (string, error) {
+	if strings.Contains(name, "/") {
+		path := name
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(s.Dir(), path)
+		}
+		if err := checkExecutable(path); err != nil {
+			return "", s.lookPathError(name, err)
+		}
+		return path, nil
+	}
+
+	pathEnv := s.Getenv("PATH")
+	s.mu.Lock()
+	if e, ok := s.hash[name]; ok {
+		s.mu.Unlock()
+		// Файл могли удалить или переместить — тогда ищем заново
+		if checkExecutable(e.path) == nil {
+			s.mu.Lock()
+			e.hits++
+			s.mu.Unlock()
+			return e.path, nil
+		}
+		s.mu.Lock()
+		delete(s.hash, name)
+	}
+	s.mu.Unlock()
+
+	path, err := s.searchPath(name, pathEnv)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hash == nil {
+		s.hash = make(map[string]*hashEntry)
+	}
+	s.hash[name] = &hashEntry{path: path, hits: 1}
+	return path, nil
+}
+
+// Rehash ищет команду заново и кладет в кэш без увеличения счетчика (hash NAME).
+func (s *Shell) Rehash(name string) error {
+	s.mu.Lock()
+	delete(s.hash, name)
+	s.mu.Unlock()
+
+	if _, err := s.LookPath(name); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.hash[name]; ok {
+		e.hits = 0
+	}
+	return nil
+}
+
+// ResetHash очищает кэш путей (hash -r).
+func (s *Shell) ResetHash() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hash = nil
+}
+
+// HashEntries возвращает содержимое кэша, отсортированное по имени.
+func (s *Shell) HashEntries() []HashEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]HashEntry, 0, len(s.hash))
+	for name, e := range s.hash {
+		out = append(out, HashEntry{Name: name, Path: e.path, Hits: e.hits})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (s *Shell) searchPath(name, pathEnv string) (string, error) {
+	var denied error
+	for _, dir := range filepath.SplitList(pathEnv) {
+		// Пустой элемент PATH означает текущий каталог
+		if dir == "" {
+			dir = "."
+		}
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(s.Dir(), dir)
+		}
+		path := filepath.Join(dir, name)
+		err := checkExecutable(path)
+		if err == nil {
+			return path, nil
+		}
+		if !os.IsNotExist(err) && denied == nil {
+			denied = err
+		}
+	}
+	if denied != nil {
+		return "", s.lookPathError(name, denied)
+	}
+	return "", &StatusError{Code: 127, Err: fmt.Errorf("%s: command not found", name)}
+}
+
+func (s *Shell) lookPathError(name string, err error) error {
+	if os.IsNotExist(err) {
+		return &StatusError{Code: 127, Err: fmt.Errorf("%s: No such file or directory", name)}
+	}
+	return &StatusError{Code: 126, Err: fmt.Errorf("%s: %v", name, err)}
+}
+
+func checkExecutable(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return errors.New("Is a directory")
+	}
+	if info.Mode().Perm()&0o111 == 0 {
+		return errors.New("Permission denied")
+	}
+	return nil
+}
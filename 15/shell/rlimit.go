@@ -0,0 +1,32 @@
+package shell
+
+// Лимиты ресурсов нельзя выставить exec.Cmd напрямую: в Go нет хука между fork и exec.
+// Поэтому команда запускается через повторный вызов текущего бинарника с служебным
+// аргументом — дочерний процесс выставляет setrlimit и делает exec нужной программы
+// (см. RunRlimitHelper).
+const rlimitHelperArg = "__shell_rlimit_exec"
+
+// RlimInfinity — значение "unlimited"
+const RlimInfinity = ^uint64(0)
+
+// Resource описывает ресурс, доступный через ulimit.
+type Resource struct {
+	Flag     byte   // флаг ulimit: t, v, n, u
+	Name     string // описание для ulimit -a
+	resource int
+	unit     uint64 // множитель из единиц ulimit в единицы setrlimit
+}
+
+// Resources возвращает поддерживаемые на этой платформе ресурсы.
+func Resources() []Resource {
+	return resources
+}
+
+func lookupResource(flag byte) (Resource, bool) {
+	for _, r := range resources {
+		if r.Flag == flag {
+			return r, true
+		}
+	}
+	return Resource{}, false
+}
@@ -0,0 +1,23 @@
+package shell
+
+import (
+	"runtime"
+	"syscall"
+)
+
+// RLIMIT_NPROC нет в пакете syscall. Номер — из include/uapi/asm-generic/resource.h (6);
+// в Linux на mips нумерация ресурсов своя (arch/mips/include/uapi/asm/resource.h), там 8.
+var rlimitNproc = func() int {
+	switch runtime.GOARCH {
+	case "mips", "mipsle", "mips64", "mips64le":
+		return 8
+	}
+	return 6
+}()
+
+var resources = []Resource{
+	{Flag: 't', Name: "cpu time (seconds)", resource: syscall.RLIMIT_CPU, unit: 1},
+	{Flag: 'v', Name: "virtual memory (kbytes)", resource: syscall.RLIMIT_AS, unit: 1024},
+	{Flag: 'n', Name: "open files", resource: syscall.RLIMIT_NOFILE, unit: 1},
+	{Flag: 'u', Name: "max user processes", resource: rlimitNproc, unit: 1},
+}
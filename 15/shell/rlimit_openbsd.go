@@ -0,0 +1,9 @@
+package shell
+
+import "syscall"
+
+// В OpenBSD нет RLIMIT_AS
+var resources = []Resource{
+	{Flag: 't', Name: "cpu time (seconds)", resource: syscall.RLIMIT_CPU, unit: 1},
+	{Flag: 'n', Name: "open files", resource: syscall.RLIMIT_NOFILE, unit: 1},
+}
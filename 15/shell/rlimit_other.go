@@ -0,0 +1,11 @@
+//go:build unix && !linux && !openbsd
+
+package shell
+
+import "syscall"
+
+var resources = []Resource{
+	{Flag: 't', Name: "cpu time (seconds)", resource: syscall.RLIMIT_CPU, unit: 1},
+	{Flag: 'v', Name: "virtual memory (kbytes)", resource: syscall.RLIMIT_AS, unit: 1024},
+	{Flag: 'n', Name: "open files", resource: syscall.RLIMIT_NOFILE, unit: 1},
+}
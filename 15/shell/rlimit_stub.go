@@ -0,0 +1,26 @@
+//go:build !unix
+
+package shell
+
+import "errors"
+
+// Вне unix setrlimit нет: ulimit ничего не показывает и не меняет.
+var resources []Resource
+
+var errNoRlimit = errors.New("ulimit: resource limits are not supported on this platform")
+
+// RunRlimitHelper ничего не делает: команды с лимитами здесь не запускаются.
+func RunRlimitHelper() {}
+
+func (s *Shell) SetLimit(flag byte, value uint64) error {
+	return errNoRlimit
+}
+
+func (s *Shell) Limit(flag byte) (uint64, error) {
+	return 0, errNoRlimit
+}
+
+// LimitedCommand возвращает команду без изменений.
+func (s *Shell) LimitedCommand(name string, args []string) (string, []string, error) {
+	return name, args, nil
+}
@@ -0,0 +1,73 @@
+//go:build unix
+
+package shell
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Команды с лимитами запускаются через этот же тестовый бинарник
+	RunRlimitHelper()
+	os.Exit(m.Run())
+}
+
+func TestLimitedCommand(t *testing.T) {
+	s := New()
+	if name, args, _ := s.LimitedCommand("/bin/sh", []string{"-c", "true"}); name != "/bin/sh" || len(args) != 2 {
+		t.Errorf("command without limits changed: %s %v", name, args)
+	}
+
+	if err := s.SetLimit('n', 64); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Limit('n'); err != nil || v != 64 {
+		t.Errorf("Limit('n') = %d, %v", v, err)
+	}
+	name, args, err := s.LimitedCommand("/bin/sh", []string{"-c", "ulimit -n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := exec.Command(name, args...).CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	if got := strings.TrimSpace(string(out)); got != "64" {
+		t.Errorf("child open files limit = %q, want 64", got)
+	}
+}
+
+func TestLimitedCommandWithoutHelper(t *testing.T) {
+	// Без RunRlimitHelper повторный вызов запустил бы саму программу
+	rlimitHelperInstalled = false
+	defer func() { rlimitHelperInstalled = true }()
+
+	s := New()
+	if name, _, err := s.LimitedCommand("/bin/sh", nil); err != nil || name != "/bin/sh" {
+		t.Errorf("command without limits: %s, %v", name, err)
+	}
+	if err := s.SetLimit('n', 64); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.LimitedCommand("/bin/sh", nil); !errors.Is(err, errNoRlimitHelper) {
+		t.Errorf("err = %v, want %v", err, errNoRlimitHelper)
+	}
+}
+
+func TestSetLimitErrors(t *testing.T) {
+	s := New()
+	if err := s.SetLimit('x', 1); err == nil {
+		t.Error("unknown resource accepted")
+	}
+	// В килобайтах: при умножении на 1024 переполнит rlim_t
+	if err := s.SetLimit('v', RlimInfinity/1024+1); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("overflowing limit: %v", err)
+	}
+	if _, ok := s.limits['v']; ok {
+		t.Error("rejected limit was stored")
+	}
+}
@@ -0,0 +1,192 @@
+//go:build unix
+
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// RLIM_INFINITY: в Linux — (rlim_t)-1, в Solaris и illumos — (rlim_t)-3,
+// в macOS и BSD — максимальный int64
+var rlimInfinity = func() uint64 {
+	switch runtime.GOOS {
+	case "linux":
+		return ^uint64(0)
+	case "solaris", "illumos":
+		return ^uint64(0) - 2
+	}
+	return 1<<63 - 1
+}()
+
+// RunRlimitHelper нужно вызвать в начале main у программ, где работает ulimit:
+// команды с лимитами запускаются повторным вызовом того же бинарника. В служебном
+// режиме функция выставляет лимиты и заменяет процесс командой, не возвращаясь;
+// при обычном запуске сразу возвращает управление.
+func RunRlimitHelper() {
+	if len(os.Args) > 1 && os.Args[1] == rlimitHelperArg {
+		runRlimitHelper(os.Args[2:])
+	}
+	rlimitHelperInstalled = true
+}
+
+// rlimitHelperInstalled — программа вызвала RunRlimitHelper. Без этого повторный
+// вызов бинарника запустил бы ее саму, а не команду.
+var rlimitHelperInstalled bool
+
+var errNoRlimitHelper = errors.New("ulimit: RunRlimitHelper not installed")
+
+// SetLimit задает лимит для дочерних процессов в единицах ulimit.
+func (s *Shell) SetLimit(flag byte, value uint64) error {
+	r, ok := lookupResource(flag)
+	if !ok {
+		return fmt.Errorf("ulimit: -%c: invalid option", flag)
+	}
+	// Значение в единицах setrlimit должно поместиться в rlim_t и не совпасть с бесконечностью
+	if value != RlimInfinity && value > (rlimInfinity-1)/r.unit {
+		return fmt.Errorf("ulimit: %d: limit out of range", value)
+	}
+	_, hard, err := getrlimit(r.resource)
+	if err != nil {
+		return fmt.Errorf("ulimit: %v", err)
+	}
+	// Поднять выше жесткого лимита оболочки без привилегий не получится
+	if hard != RlimInfinity && (value == RlimInfinity || value*r.unit > hard) {
+		return fmt.Errorf("ulimit: %s: cannot modify limit: operation not permitted", r.Name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.limits == nil {
+		s.limits = make(map[byte]uint64)
+	}
+	s.limits[flag] = value
+	return nil
+}
+
+// Limit возвращает действующий для дочерних процессов лимит в единицах ulimit:
+// заданный через SetLimit или унаследованный мягкий лимит оболочки.
+func (s *Shell) Limit(flag byte) (uint64, error) {
+	r, ok := lookupResource(flag)
+	if !ok {
+		return 0, fmt.Errorf("ulimit: -%c: invalid option", flag)
+	}
+	s.mu.Lock()
+	v, ok := s.limits[flag]
+	s.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+
+	soft, _, err := getrlimit(r.resource)
+	if err != nil {
+		return 0, fmt.Errorf("ulimit: %v", err)
+	}
+	if soft == RlimInfinity {
+		return RlimInfinity, nil
+	}
+	return soft / r.unit, nil
+}
+
+// getrlimit возвращает мягкий и жесткий лимиты; бесконечность — RlimInfinity.
+func getrlimit(resource int) (soft, hard uint64, err error) {
+	var rl syscall.Rlimit
+	if err := syscall.Getrlimit(resource, &rl); err != nil {
+		return 0, 0, err
+	}
+	return fromRlim(rl.Cur), fromRlim(rl.Max), nil
+}
+
+// setrlimit выставляет оба лимита; value — в единицах setrlimit или RlimInfinity.
+func setrlimit(resource int, value uint64) error {
+	if value == RlimInfinity {
+		value = rlimInfinity
+	}
+	var rl syscall.Rlimit
+	toRlim(&rl.Cur, value)
+	toRlim(&rl.Max, value)
+	return syscall.Setrlimit(resource, &rl)
+}
+
+// В FreeBSD и DragonFly поля syscall.Rlimit — int64, в остальных системах — uint64.
+func fromRlim[T int64 | uint64](v T) uint64 {
+	if uint64(v) >= rlimInfinity {
+		return RlimInfinity
+	}
+	return uint64(v)
+}
+
+func toRlim[T int64 | uint64](field *T, v uint64) {
+	*field = T(v)
+}
+
+// LimitedCommand возвращает имя и аргументы для запуска команды с учетом ulimit.
+// Если лимиты не заданы, команда возвращается без изменений. Если лимиты заданы,
+// а программа не вызвала RunRlimitHelper, возвращается ошибка.
+func (s *Shell) LimitedCommand(name string, args []string) (string, []string, error) {
+	s.mu.Lock()
+	var spec []string
+	for flag, v := range s.limits {
+		spec = append(spec, string(flag)+"="+strconv.FormatUint(v, 10))
+	}
+	s.mu.Unlock()
+	if len(spec) == 0 {
+		return name, args, nil
+	}
+	if !rlimitHelperInstalled {
+		return "", nil, errNoRlimitHelper
+	}
+	sort.Strings(spec)
+
+	self, err := os.Executable()
+	if err != nil {
+		return "", nil, err
+	}
+	helperArgs := append([]string{rlimitHelperArg, strings.Join(spec, ","), name}, args...)
+	return self, helperArgs, nil
+}
+
+func runRlimitHelper(args []string) {
+	if len(args) < 2 {
+		fmt.Fprintln(os.Stderr, "ulimit: missing command")
+		os.Exit(2)
+	}
+	spec, name, argv := args[0], args[1], args[1:]
+
+	for _, item := range strings.Split(spec, ",") {
+		k, v, _ := strings.Cut(item, "=")
+		value, err := strconv.ParseUint(v, 10, 64)
+		if len(k) != 1 || err != nil {
+			fmt.Fprintf(os.Stderr, "ulimit: bad limit %q\n", item)
+			os.Exit(2)
+		}
+		r, ok := lookupResource(k[0])
+		if !ok {
+			continue
+		}
+		limit := value
+		if value != RlimInfinity {
+			limit = value * r.unit
+		}
+		if err := setrlimit(r.resource, limit); err != nil {
+			fmt.Fprintf(os.Stderr, "ulimit: %s: %v\n", r.Name, err)
+			os.Exit(1)
+		}
+	}
+
+	path, err := exec.LookPath(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+		os.Exit(127)
+	}
+	err = syscall.Exec(path, argv, os.Environ())
+	fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+	os.Exit(126)
+}
@@ -1,18 +1,152 @@
 package shell
 
 import (
+	"context"
+	"io"
 	"os"
 	"os/exec"
+	"sort"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 )
 
+// KillTimeout — сколько ждать после SIGTERM перед SIGKILL
+const KillTimeout = 2 * time.Second
+
+// Builtin — встроенная команда. Аргументы уже раскрыты, потоки настроены под пайплайн.
+type Builtin func(ctx context.Context, sh *Shell, args []string, stdin io.Reader, stdout io.Writer) error
+
 type Shell struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// Builtins — реестр встроенных команд, имя -> реализация
+	Builtins map[string]Builtin
+
+	// LastStatus — код возврата последней команды ($?)
+	LastStatus int
+
+	dir    string
+	env    map[string]string
+	limits map[byte]uint64 // ulimit для дочерних процессов
+
+	hash map[string]*hashEntry // кэш путей к командам, сбрасывается при смене PATH
+
+	functions map[string]string
+	params    []string
+
+	options map[string]bool // set -o
+
 	currentProcesses []*exec.Cmd
 	mu               sync.Mutex
 }
 
+// New создает оболочку со стандартными потоками, текущим каталогом и окружением процесса.
+func New() *Shell {
+	dir, _ := os.Getwd()
+	s := &Shell{
+		Stdin:    os.Stdin,
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+		Builtins: make(map[string]Builtin),
+		dir:      dir,
+	}
+	s.SetEnviron(os.Environ())
+	return s
+}
+
+// Dir возвращает текущий каталог оболочки (не процесса).
+func (s *Shell) Dir() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dir
+}
+
+func (s *Shell) SetDir(dir string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dir = dir
+}
+
+func (s *Shell) Getenv(key string) string {
+	v, _ := s.LookupEnv(key)
+	return v
+}
+
+func (s *Shell) LookupEnv(key string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.env[key]
+	return v, ok
+}
+
+func (s *Shell) Setenv(key, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.env == nil {
+		s.env = make(map[string]string)
+	}
+	if key == "PATH" && s.env[key] != value {
+		s.hash = nil
+	}
+	s.env[key] = value
+}
+
+func (s *Shell) Unsetenv(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if key == "PATH" {
+		s.hash = nil
+	}
+	delete(s.env, key)
+}
+
+// SetEnviron заменяет окружение списком в формате KEY=VALUE.
+func (s *Shell) SetEnviron(environ []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hash = nil
+	s.env = make(map[string]string, len(environ))
+	for _, kv := range environ {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			continue
+		}
+		s.env[k] = v
+	}
+}
+
+// Environ возвращает окружение в формате KEY=VALUE для exec.Cmd.Env.
+func (s *Shell) Environ() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]string, 0, len(s.env))
+	for k, v := range s.env {
+		out = append(out, k+"="+v)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Option возвращает состояние опции set -o (например, xtrace).
+func (s *Shell) Option(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.options[name]
+}
+
+func (s *Shell) SetOption(name string, on bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.options == nil {
+		s.options = make(map[string]bool)
+	}
+	s.options[name] = on
+}
+
 func (s *Shell) AddProcess(cmd *exec.Cmd) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -39,9 +173,9 @@ func (s *Shell) KillAllProcesses() {
 			// Мягкое завершение
 			p.Process.Signal(syscall.SIGTERM)
 
-			// Жесткое завершение через 2 секунды если не ответил
+			// Жесткое завершение через KillTimeout если не ответил
 			go func(proc *os.Process) {
-				time.Sleep(2 * time.Second)
+				time.Sleep(KillTimeout)
 				proc.Kill()
 			}(p.Process)
 		}
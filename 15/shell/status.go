@@ -0,0 +1,58 @@
+package shell
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+)
+
+// StatusError — ошибка с явным кодом возврата.
+type StatusError struct {
+	Code int
+	Err  error
+}
+
+func (e *StatusError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit status %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
+func (e *StatusError) Unwrap() error {
+	return e.Err
+}
+
+// ExitRequest возвращается встроенной командой exit.
+type ExitRequest struct {
+	Code int
+}
+
+func (e *ExitRequest) Error() string {
+	return fmt.Sprintf("exit %d", e.Code)
+}
+
+// ExitStatus переводит ошибку выполнения в код возврата как в sh:
+// 0 — успех, код процесса, 128+N при завершении сигналом N, 1 — прочие ошибки.
+func ExitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.Code
+	}
+	var er *ExitRequest
+	if errors.As(err, &er) {
+		return er.Code
+	}
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		if ws, ok := ee.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+			return 128 + int(ws.Signal())
+		}
+		return ee.ExitCode()
+	}
+	return 1
+}
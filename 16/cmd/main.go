@@ -2,13 +2,16 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/url"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
@@ -25,6 +28,39 @@ func main() {
 		userAgent     string
 		respectRobots bool
 		sameHostOnly  bool
+		resume        bool
+		incremental   bool
+		sitemaps      bool
+		maxFileSize   int64
+		hostConns     int
+		hostRPS       float64
+		retries       int
+		retryDelay    time.Duration
+		retryMaxDelay time.Duration
+		retryStatuses string
+		include       stringList
+		exclude       stringList
+		allowMIME     string
+		denyMIME      string
+		maxPages      int
+		maxBytes      int64
+		maxTime       time.Duration
+		warcPrefix    string
+		warcMaxSize   int64
+		warcOnly      bool
+		domains       string
+		requisites    bool
+		sortQuery     bool
+		stripParams   string
+		foldSlash     bool
+		relCanonical  bool
+		manifest      string
+		report        string
+		progress      bool
+		metricsAddr   string
+		check         bool
+		archive       string
+		dedup         bool
 	)
 
 	flag.StringVar(&rawURL, "url", "", "Стартовый URL (обязательный)")
@@ -35,6 +71,41 @@ func main() {
 	flag.StringVar(&userAgent, "user-agent", "site-mirror/1.0 (+https://example.local)", "User-Agent")
 	flag.BoolVar(&respectRobots, "respect-robots", true, "Учитывать robots.txt")
 	flag.BoolVar(&sameHostOnly, "same-host-only", true, "Скачивать только с того же хоста")
+	flag.BoolVar(&resume, "resume", false, "Продолжить прерванный обход по сохраненному состоянию")
+	flag.BoolVar(&incremental, "incremental", true, "Не скачивать заново неизменившиеся файлы (If-None-Match/If-Modified-Since)")
+	flag.BoolVar(&sitemaps, "sitemaps", false, "Добавлять URL из sitemap.xml и Sitemap: в robots.txt (как стартовые, с полной глубиной)")
+	flag.Int64Var(&maxFileSize, "max-file-size", 0, "Макс. размер скачиваемого файла в байтах (0 — без ограничения); больше — пропускается")
+	flag.IntVar(&hostConns, "host-concurrency", 0, "Макс. число одновременных запросов к одному хосту (0 — без ограничения)")
+	flag.Float64Var(&hostRPS, "host-rps", 0, "Макс. число запросов в секунду к одному хосту (0 — без ограничения)")
+	defRetry := mirror.DefaultRetryPolicy()
+	flag.IntVar(&retries, "retries", defRetry.MaxAttempts, "Число попыток загрузки одного URL, включая первую")
+	flag.DurationVar(&retryDelay, "retry-delay", defRetry.BaseDelay, "Задержка перед первым повтором, дальше удваивается")
+	flag.DurationVar(&retryMaxDelay, "retry-max-delay", defRetry.MaxDelay, "Макс. задержка между повторами, в том числе по Retry-After (0 — без ограничения)")
+	flag.StringVar(&retryStatuses, "retry-statuses", "408,425,429,500,502,503,504", "HTTP-коды, при которых загрузка повторяется")
+	flag.StringVar(&domains, "domains", "", "Хосты, страницы с которых обходятся, через запятую (\"example.com,*.example.org\"); заменяет -same-host-only")
+	flag.BoolVar(&requisites, "page-requisites", false, "Скачивать картинки, стили и скрипты страниц с любых хостов (например, с CDN), не обходя их дальше")
+	defCanon := mirror.DefaultCanonicalization()
+	flag.BoolVar(&sortQuery, "canonical-sort-query", defCanon.SortQuery, "Считать URL с одинаковыми параметрами в разном порядке одним URL")
+	flag.StringVar(&stripParams, "strip-params", strings.Join(defCanon.StripParams, ","), "Параметры запроса, которые отбрасываются при сравнении URL, через запятую (\"utm_*\" — префикс); пусто — не отбрасывать")
+	flag.BoolVar(&foldSlash, "fold-trailing-slash", false, "Считать /docs/ и /docs одной страницей")
+	flag.BoolVar(&relCanonical, "rel-canonical", false, "Не сохранять отдельно страницы, объявившие <link rel=\"canonical\"> на другой URL")
+	flag.Var(&include, "include", "Скачивать только страницы, чей путь?query подходит под glob (\"/docs/*\") или regexp (\"re:...\"); можно повторять")
+	flag.Var(&exclude, "exclude", "Не скачивать URL, чей путь?query подходит под glob или regexp (\"re:...\"); можно повторять")
+	flag.StringVar(&allowMIME, "allow-mime", "", "Сохранять только эти типы содержимого через запятую (\"text/html,image/*\")")
+	flag.StringVar(&denyMIME, "deny-mime", "", "Не сохранять эти типы содержимого через запятую")
+	flag.IntVar(&maxPages, "max-pages", 0, "Макс. число скачиваемых страниц (0 — без ограничения)")
+	flag.Int64Var(&maxBytes, "max-bytes", 0, "Макс. суммарный объем скачанного в байтах (0 — без ограничения)")
+	flag.DurationVar(&maxTime, "max-time", 0, "Макс. время обхода (0 — без ограничения); по истечении можно продолжить с -resume")
+	flag.StringVar(&warcPrefix, "warc", "", "Писать все HTTP-обмены в WARC: префикс имени файлов (\"crawl\" -> crawl-<время>-00000.warc.gz)")
+	flag.Int64Var(&warcMaxSize, "warc-max-size", 1<<30, "Размер сегмента WARC в байтах, после которого начинается новый файл")
+	flag.BoolVar(&warcOnly, "warc-only", false, "Только WARC, без файлов зеркала (требует -warc)")
+	flag.StringVar(&manifest, "manifest", "", "Записать итог по каждому URL в файл (JSON lines)")
+	flag.StringVar(&report, "report", "", "Записать сводку обхода в файл (JSON): статусы, самые медленные и большие ресурсы")
+	flag.BoolVar(&progress, "progress", isTerminal(os.Stderr), "Показывать строку прогресса (по умолчанию — если вывод в терминал)")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "Адрес для метрик Prometheus на /metrics (\"127.0.0.1:9100\"); пусто — не запускать")
+	flag.BoolVar(&check, "check", false, "Проверка ссылок: ничего не сохранять, вывести недоступные ссылки и страницы, где они встречаются; код выхода 1, если такие есть")
+	flag.StringVar(&archive, "archive", "", "Сохранить зеркало одним архивом вместо каталога: .tar, .tar.gz, .tgz или .zip (без -resume и -incremental)")
+	flag.BoolVar(&dedup, "dedup", false, "Не хранить одинаковые файлы дважды: жесткая ссылка на первую копию (в zip — ссылки страниц на нее)")
 	flag.Parse()
 
 	if rawURL == "" {
@@ -48,12 +119,49 @@ func main() {
 		log.Fatalf("Некорректный URL: %v", err)
 	}
 
-	absOut, err := filepath.Abs(outDir)
+	if warcOnly && warcPrefix == "" {
+		log.Fatalf("-warc-only требует -warc")
+	}
+
+	statuses, err := mirror.ParseStatusList(retryStatuses)
 	if err != nil {
-		log.Fatalf("Не удалось получить абсолютный путь к out: %v", err)
+		log.Fatalf("Некорректный -retry-statuses: %v", err)
+	}
+
+	var (
+		absOut string
+		store  *mirror.ArchiveStorage
+		// cleanup удаляет временный каталог проверки ссылок. log.Fatalf и os.Exit
+		// отложенные вызовы не выполняют, поэтому перед ними он вызывается явно
+		cleanup = func() {}
+	)
+	fatalf := func(format string, args ...any) {
+		cleanup()
+		log.Fatalf(format, args...)
 	}
-	if err := os.MkdirAll(absOut, 0o755); err != nil {
-		log.Fatalf("Не удалось создать каталог %s: %v", absOut, err)
+	switch {
+	case check:
+		// Зеркала нет, каталог нужен только под временные файлы
+		absOut, err = os.MkdirTemp("", "site-mirror-check-")
+		if err != nil {
+			log.Fatalf("Не удалось создать временный каталог: %v", err)
+		}
+		tmpDir := absOut
+		cleanup = func() { os.RemoveAll(tmpDir) }
+		defer cleanup()
+	case archive != "":
+		store, err = mirror.NewArchiveStorage(archive)
+		if err != nil {
+			log.Fatalf("Не удалось создать архив: %v", err)
+		}
+	default:
+		absOut, err = filepath.Abs(outDir)
+		if err != nil {
+			log.Fatalf("Не удалось получить абсолютный путь к out: %v", err)
+		}
+		if err := os.MkdirAll(absOut, 0o755); err != nil {
+			log.Fatalf("Не удалось создать каталог %s: %v", absOut, err)
+		}
 	}
 
 	cfg := mirror.Config{
@@ -65,6 +173,55 @@ func main() {
 		UserAgent:      userAgent,
 		RespectRobots:  respectRobots,
 		SameHostOnly:   sameHostOnly,
+		Resume:         resume,
+		Incremental:    incremental,
+		Sitemaps:       sitemaps,
+		MaxFileSize:    maxFileSize,
+
+		HostConcurrency: hostConns,
+		HostRPS:         hostRPS,
+
+		Retry: mirror.RetryPolicy{
+			MaxAttempts:   retries,
+			BaseDelay:     retryDelay,
+			MaxDelay:      retryMaxDelay,
+			RetryStatuses: statuses,
+			NetworkErrors: true,
+		},
+
+		Canonical: mirror.Canonicalization{
+			SortQuery:         sortQuery,
+			StripParams:       splitList(stripParams),
+			FoldTrailingSlash: foldSlash,
+			RelCanonical:      relCanonical,
+		},
+
+		AllowedDomains: splitList(domains),
+		PageRequisites: requisites,
+
+		Include:     include,
+		Exclude:     exclude,
+		AllowMIME:   splitList(allowMIME),
+		DenyMIME:    splitList(denyMIME),
+		MaxPages:    maxPages,
+		MaxBytes:    maxBytes,
+		MaxDuration: maxTime,
+
+		WARCPrefix:  warcPrefix,
+		WARCMaxSize: warcMaxSize,
+		WARCOnly:    warcOnly,
+
+		Manifest: manifest,
+		Report:   report,
+
+		Progress:    progress,
+		MetricsAddr: metricsAddr,
+
+		CheckLinks: check,
+		Dedup:      dedup,
+	}
+	if store != nil {
+		cfg.Storage = store
 	}
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
@@ -72,11 +229,78 @@ func main() {
 
 	c, err := mirror.NewCrawler(cfg)
 	if err != nil {
-		log.Fatalf("Ошибка инициализации: %v", err)
+		fatalf("Ошибка инициализации: %v", err)
 	}
-	if err := c.Run(ctx); err != nil {
-		log.Fatalf("Завершено с ошибкой: %v", err)
+	runErr := c.Run(ctx)
+	// Архив дописывается и при прерывании: в нем то, что успели скачать
+	if store != nil {
+		if err := store.Close(); err != nil && runErr == nil {
+			runErr = fmt.Errorf("архив: %w", err)
+		}
+	}
+	if err := runErr; err != nil {
+		if errors.Is(err, context.Canceled) {
+			if check || store != nil {
+				// Удаляется только временный каталог проверки; архив остается с тем, что успели скачать
+				log.Println("Прервано.")
+				cleanup()
+			} else {
+				log.Println("Прервано. Состояние сохранено, продолжить можно с флагом -resume.")
+			}
+			os.Exit(130)
+		}
+		fatalf("Завершено с ошибкой: %v", err)
+	}
+
+	if check {
+		broken := c.BrokenLinks()
+		printBrokenLinks(os.Stdout, broken)
+		if len(broken) > 0 {
+			cleanup()
+			os.Exit(1)
+		}
+		log.Println("Недоступных ссылок нет.")
+		return
 	}
 
 	log.Println("Готово.")
 }
+
+// printBrokenLinks выводит недоступные ссылки, под каждой — страницы, где она встречается.
+func printBrokenLinks(w io.Writer, broken []mirror.BrokenLink) {
+	for _, b := range broken {
+		fmt.Fprintf(w, "%s: %s\n", b.URL, b.Error)
+		for _, ref := range b.Referrers {
+			fmt.Fprintf(w, "\t%s\n", ref)
+		}
+	}
+	if len(broken) > 0 {
+		fmt.Fprintf(w, "Недоступных ссылок: %d\n", len(broken))
+	}
+}
+
+// stringList — флаг, который можно указать несколько раз
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+func splitList(s string) []string {
+	var out []string
+	for _, p := range strings.Split(s, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// isTerminal — f подключен к терминалу, а не к файлу или каналу.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,219 @@
+package mirror
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArchiveStorage пишет зеркало одним архивом tar или zip. Файлы добавляются по мере
+// скачивания, переписать добавленный нельзя — поэтому HTML и CSS попадают в архив
+// после преобразования ссылок.
+type ArchiveStorage struct {
+	mu    sync.Mutex
+	tw    *tar.Writer
+	zw    *zip.Writer
+	gz    *gzip.Writer // tar.gz
+	f     *os.File     // если архив создан NewArchiveStorage
+	names map[string]bool
+}
+
+// NewArchiveStorage создает архив; формат — по расширению: .tar, .tar.gz, .tgz или .zip.
+func NewArchiveStorage(path string) (*ArchiveStorage, error) {
+	lower := strings.ToLower(path)
+	var mk func(io.Writer) *ArchiveStorage
+	gzipped := false
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		mk = NewZipStorage
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		mk, gzipped = NewTarStorage, true
+	case strings.HasSuffix(lower, ".tar"):
+		mk = NewTarStorage
+	default:
+		return nil, fmt.Errorf("неизвестный формат архива %s: нужен .tar, .tar.gz, .tgz или .zip", path)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	var w io.Writer = f
+	var gz *gzip.Writer
+	if gzipped {
+		gz = gzip.NewWriter(f)
+		w = gz
+	}
+	s := mk(w)
+	s.f, s.gz = f, gz
+	return s, nil
+}
+
+// NewTarStorage пишет tar в w; w закрывает вызывающий после Close.
+func NewTarStorage(w io.Writer) *ArchiveStorage {
+	return &ArchiveStorage{tw: tar.NewWriter(w), names: make(map[string]bool)}
+}
+
+// NewZipStorage пишет zip в w; w закрывает вызывающий после Close.
+func NewZipStorage(w io.Writer) *ArchiveStorage {
+	return &ArchiveStorage{zw: zip.NewWriter(w), names: make(map[string]bool)}
+}
+
+// Put добавляет файл. Заголовок с размером пишется раньше тела, а недописанную запись
+// из архива не убрать (tar после нее непригоден, в zip остается обрывок под тем же
+// именем), поэтому тело сначала читается целиком: во временный файл, если оно
+// еще не в памяти. Размер сверяется до того, как в архив что-то записано.
+func (s *ArchiveStorage) Put(name string, r io.Reader, size int64) error {
+	if !fs.ValidPath(name) {
+		return fmt.Errorf("недопустимый путь в зеркале: %q", name)
+	}
+	if s.has(name) {
+		return fmt.Errorf("%s уже есть в архиве", name)
+	}
+	if br, ok := r.(interface{ Len() int }); ok {
+		if n := int64(br.Len()); n != size {
+			return fmt.Errorf("%s: прочитано %d байт из %d", name, n, size)
+		}
+		return s.add(name, r, size)
+	}
+
+	f, err := os.CreateTemp("", "site-mirror-archive-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	n, err := io.Copy(f, r)
+	if err == nil && n != size {
+		err = fmt.Errorf("%s: прочитано %d байт из %d", name, n, size)
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return err
+	}
+	return s.add(name, f, size)
+}
+
+func (s *ArchiveStorage) has(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.names[name]
+}
+
+// add пишет в архив запись с телом из r, в котором ровно size байт.
+func (s *ArchiveStorage) add(name string, r io.Reader, size int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.names[name] {
+		return fmt.Errorf("%s уже есть в архиве", name)
+	}
+
+	now := time.Now()
+	var w io.Writer
+	if s.tw != nil {
+		err := s.tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0o644,
+			Size:     size,
+			ModTime:  now,
+			Format:   tar.FormatPAX,
+		})
+		if err != nil {
+			return err
+		}
+		w = s.tw
+	} else {
+		h := &zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now}
+		h.SetMode(0o644)
+		zf, err := s.zw.CreateHeader(h)
+		if err != nil {
+			return err
+		}
+		w = zf
+	}
+	n, err := io.Copy(w, r)
+	if err == nil && n != size {
+		err = fmt.Errorf("%s: записано %d байт из %d", name, n, size)
+	}
+	if err != nil {
+		return err
+	}
+	// Имя занято, только когда запись удалась: иначе повтор упрется в "уже есть"
+	s.names[name] = true
+	return nil
+}
+
+// Link добавляет в tar запись-ссылку на уже добавленный файл; в zip ссылок нет.
+func (s *ArchiveStorage) Link(existing, name string) error {
+	if s.tw == nil {
+		return errors.New("zip не поддерживает ссылки на файлы")
+	}
+	if !fs.ValidPath(name) {
+		return fmt.Errorf("недопустимый путь в зеркале: %q", name)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.names[existing] || s.names[name] {
+		return fmt.Errorf("нельзя сослаться из %s на %s", name, existing)
+	}
+	err := s.tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeLink,
+		Name:     name,
+		Linkname: existing,
+		Mode:     0o644,
+		ModTime:  time.Now(),
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return err
+	}
+	s.names[name] = true
+	return nil
+}
+
+// PutFile добавляет скачанный файл: его размер уже известен, копия не нужна.
+func (s *ArchiveStorage) PutFile(name, tmpPath string) error {
+	if !fs.ValidPath(name) {
+		return fmt.Errorf("недопустимый путь в зеркале: %q", name)
+	}
+	f, err := os.Open(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return s.add(name, f, fi.Size())
+}
+
+// Close дописывает оглавление архива и, если архив создан NewArchiveStorage, закрывает файл.
+func (s *ArchiveStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var errs []error
+	if s.tw != nil {
+		errs = append(errs, s.tw.Close())
+	} else {
+		errs = append(errs, s.zw.Close())
+	}
+	if s.gz != nil {
+		errs = append(errs, s.gz.Close())
+	}
+	if s.f != nil {
+		errs = append(errs, s.f.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,135 @@
+package mirror
+
+import (
+	"encoding/json"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Сайдкар-манифест с валидаторами ответов (ETag/Last-Modified) для повторного зеркалирования.
+const cacheFileName = ".site-mirror-cache.json"
+
+// cacheEntry — что известно об URL с прошлого скачивания. Ссылки хранятся исходными
+// (до переписывания): в сохраненной копии они уже локальные, и обратно URL из них
+// однозначно не восстановить.
+type cacheEntry struct {
+	ETag         string       `json:"etag,omitempty"`
+	LastModified string       `json:"last_modified,omitempty"`
+	FetchedAt    time.Time    `json:"fetched_at"`
+	LocalPath    string       `json:"local_path"`
+	Size         int64        `json:"size,omitempty"`
+	SHA256       string       `json:"sha256,omitempty"`
+	Links        []cachedLink `json:"links,omitempty"`
+	// Raw — файл сохранен как скачан, а ссылки в нем так и не преобразованы
+	// (обход прервался); такую копию нельзя оставлять по 304
+	Raw bool `json:"raw,omitempty"`
+}
+
+type cachedLink struct {
+	URL  string       `json:"url"`
+	Kind ResourceKind `json:"kind"`
+}
+
+type validatorCache struct {
+	mu      sync.Mutex
+	path    string
+	entries map[string]cacheEntry
+}
+
+func loadValidatorCache(outputDir string) (*validatorCache, error) {
+	vc := &validatorCache{
+		path:    filepath.Join(outputDir, cacheFileName),
+		entries: make(map[string]cacheEntry),
+	}
+	data, err := os.ReadFile(vc.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return vc, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &vc.entries); err != nil {
+		// Поврежденный кэш не повод падать — просто скачаем все заново
+		vc.entries = make(map[string]cacheEntry)
+	}
+	return vc, nil
+}
+
+// lookup возвращает запись, только если сохраненный файл еще на месте:
+// иначе 304 нечем будет заменить. key — ключ задачи (Crawler.key исходного URL),
+// а не итогового URL после редиректов: иначе при следующем запуске запись не найдется.
+func (vc *validatorCache) lookup(key, outputDir string) (cacheEntry, bool) {
+	vc.mu.Lock()
+	e, ok := vc.entries[key]
+	vc.mu.Unlock()
+	if !ok || e.Raw {
+		return cacheEntry{}, false
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, e.LocalPath)); err != nil {
+		return cacheEntry{}, false
+	}
+	return e, true
+}
+
+func (vc *validatorCache) store(key string, res *FetchResult, localPath string, raw bool, links []discoveredLink) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	e := cacheEntry{
+		ETag:         res.ETag,
+		LastModified: res.LastModified,
+		FetchedAt:    time.Now().UTC(),
+		LocalPath:    localPath,
+		Size:         res.Size,
+		SHA256:       res.SHA256,
+		Raw:          raw,
+	}
+	for _, dl := range links {
+		e.Links = append(e.Links, cachedLink{URL: dl.URL.String(), Kind: dl.Kind})
+	}
+	vc.entries[key] = e
+}
+
+// markConverted снимает пометку Raw после преобразования ссылок в файле.
+func (vc *validatorCache) markConverted(key string) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	if e, ok := vc.entries[key]; ok {
+		e.Raw = false
+		vc.entries[key] = e
+	}
+}
+
+// unchangedSince сообщает, что копия скачана не раньше lastmod из sitemap.
+func (e cacheEntry) unchangedSince(lastmod time.Time) bool {
+	return !lastmod.IsZero() && !e.FetchedAt.IsZero() && !lastmod.After(e.FetchedAt)
+}
+
+func (vc *validatorCache) save() error {
+	vc.mu.Lock()
+	data, err := json.Marshal(vc.entries)
+	vc.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(vc.path, data, 0o644)
+}
+
+func (e cacheEntry) validators() Validators {
+	return Validators{ETag: e.ETag, LastModified: e.LastModified}
+}
+
+func (e cacheEntry) discoveredLinks() []discoveredLink {
+	out := make([]discoveredLink, 0, len(e.Links))
+	for _, l := range e.Links {
+		u, err := url.Parse(l.URL)
+		if err != nil {
+			continue
+		}
+		out = append(out, discoveredLink{URL: u, Kind: l.Kind})
+	}
+	return out
+}
@@ -0,0 +1,69 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+)
+
+func TestIncrementalThroughRedirect(t *testing.T) {
+	var (
+		mu          sync.Mutex
+		conditional = make(map[string]int)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<img src="/old.png"><a href="/page">page</a>`)
+		case "/old.png":
+			http.Redirect(w, r, "/new.png", http.StatusMovedPermanently)
+		case "/page":
+			http.Redirect(w, r, "/page/", http.StatusFound)
+		case "/new.png", "/page/":
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				mu.Lock()
+				conditional[r.URL.Path]++
+				mu.Unlock()
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", `"v1"`)
+			if r.URL.Path == "/page/" {
+				w.Header().Set("Content-Type", "text/html")
+				fmt.Fprint(w, `<a href="/">home</a>`)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "PNG")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL + "/")
+	cfg := Config{BaseURL: base, OutputDir: t.TempDir(), MaxDepth: 2, Concurrency: 1, Incremental: true}
+	for run := 1; run <= 2; run++ {
+		c, err := NewCrawler(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+
+	// Второй запуск должен найти валидаторы по исходному URL и спросить условно
+	mu.Lock()
+	defer mu.Unlock()
+	for _, p := range []string{"/new.png", "/page/"} {
+		if conditional[p] != 1 {
+			t.Errorf("conditional requests for %s: %d, want 1", p, conditional[p])
+		}
+	}
+}
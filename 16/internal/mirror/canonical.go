@@ -0,0 +1,163 @@
+package mirror
+
+import (
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Canonicalization — правила приведения URL к одному виду, чтобы одна и та же страница
+// не скачивалась и не сохранялась под разными именами. Нормализация процент-кодирования
+// и удаление "." и ".." из пути выполняются всегда.
+type Canonicalization struct {
+	// SortQuery сортирует параметры запроса: ?b=2&a=1 и ?a=1&b=2 — один URL
+	SortQuery bool
+	// StripParams — параметры, которые выбрасываются из запроса: имя или префикс
+	// со звездочкой ("utm_*"), без учета регистра. "jsessionid" убирает и ;jsessionid=... из пути.
+	StripParams []string
+	// FoldTrailingSlash считает /docs/ и /docs одной страницей (слэш отбрасывается)
+	FoldTrailingSlash bool
+	// RelCanonical — страница, объявившая <link rel="canonical"> на другой URL,
+	// считается его копией и отдельно не сохраняется
+	RelCanonical bool
+}
+
+// DefaultTrackingParams — параметры отслеживания и сессий, не влияющие на содержимое.
+var DefaultTrackingParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "gbraid", "wbraid", "msclkid", "yclid",
+	"mc_cid", "mc_eid", "_ga", "_gl", "igshid", "phpsessid", "jsessionid", "sessionid",
+}
+
+// DefaultCanonicalization — сортировка запроса и удаление параметров отслеживания.
+func DefaultCanonicalization() Canonicalization {
+	return Canonicalization{
+		SortQuery:   true,
+		StripParams: DefaultTrackingParams,
+	}
+}
+
+var jsessionPathRe = regexp.MustCompile(`(?i);jsessionid=[^/]*`)
+
+// apply возвращает канонический вид u; сам u не меняется.
+func (cz Canonicalization) apply(u *url.URL) *url.URL {
+	cp := *u
+
+	p := normalizeEscapes(cp.EscapedPath())
+	if cz.strips("jsessionid") {
+		p = jsessionPathRe.ReplaceAllString(p, "")
+	}
+	p = removeDotSegments(p)
+	if cz.FoldTrailingSlash && len(p) > 1 {
+		p = strings.TrimSuffix(p, "/")
+	}
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		cp.Path, cp.RawPath = unescaped, p
+	}
+
+	if cp.RawQuery != "" {
+		var pairs []string
+		for _, pair := range strings.Split(cp.RawQuery, "&") {
+			if pair == "" {
+				continue
+			}
+			name, _, _ := strings.Cut(pair, "=")
+			if n, err := url.QueryUnescape(name); err == nil {
+				name = n
+			}
+			if cz.strips(name) {
+				continue
+			}
+			pairs = append(pairs, normalizeEscapes(pair))
+		}
+		if cz.SortQuery {
+			sort.Strings(pairs)
+		}
+		cp.RawQuery = strings.Join(pairs, "&")
+	}
+	cp.ForceQuery = false
+	return &cp
+}
+
+func (cz Canonicalization) strips(name string) bool {
+	name = strings.ToLower(name)
+	for _, p := range cz.StripParams {
+		p = strings.ToLower(p)
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == p {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeEscapes раскодирует %XX незарезервированных символов и приводит
+// остальные к верхнему регистру (RFC 3986, 6.2.2): %7e -> ~, %2f -> %2F.
+func normalizeEscapes(s string) string {
+	if !strings.Contains(s, "%") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			c := unhex(s[i+1])<<4 | unhex(s[i+2])
+			if isUnreserved(c) {
+				b.WriteByte(c)
+			} else {
+				b.WriteString(strings.ToUpper(s[i : i+3]))
+			}
+			i += 2
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+// removeDotSegments убирает "." и ".." из пути (RFC 3986, 5.2.4); в отличие от
+// path.Clean не склеивает "//" и сохраняет завершающий слэш.
+func removeDotSegments(p string) string {
+	if !strings.Contains(p, ".") {
+		return p
+	}
+	segs := strings.Split(p, "/")
+	out := make([]string, 0, len(segs))
+	for i, s := range segs {
+		last := i == len(segs)-1
+		switch s {
+		case ".":
+			if last {
+				out = append(out, "")
+			}
+		case "..":
+			if len(out) > 1 {
+				out = out[:len(out)-1]
+			}
+			if last {
+				out = append(out, "")
+			}
+		default:
+			out = append(out, s)
+		}
+	}
+	return strings.Join(out, "/")
+}
@@ -0,0 +1,116 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCanonicalizationApply(t *testing.T) {
+	def := DefaultCanonicalization()
+	fold := def
+	fold.FoldTrailingSlash = true
+
+	tests := []struct {
+		name string
+		cz   Canonicalization
+		in   string
+		want string
+	}{
+		{name: "zero value keeps query order", in: "https://example.com/a?b=2&a=1", want: "https://example.com/a?b=2&a=1"},
+		{name: "sorted query", cz: def, in: "https://example.com/a?b=2&a=1", want: "https://example.com/a?a=1&b=2"},
+		{name: "tracking params", cz: def, in: "https://example.com/a?utm_source=x&id=7&fbclid=y&UTM_Medium=z", want: "https://example.com/a?id=7"},
+		{name: "only tracking params", cz: def, in: "https://example.com/a?gclid=1", want: "https://example.com/a"},
+		{name: "jsessionid in path", cz: def, in: "https://example.com/shop;jsessionid=ABC123?x=1", want: "https://example.com/shop?x=1"},
+		{name: "unreserved escapes decoded", in: "https://example.com/%7euser/%61b", want: "https://example.com/~user/ab"},
+		{name: "reserved escapes uppercased", in: "https://example.com/a%2fb?q=%3d", want: "https://example.com/a%2Fb?q=%3D"},
+		{name: "dot segments", in: "https://example.com/a/./b/../c/", want: "https://example.com/a/c/"},
+		{name: "dot segments keep double slash", in: "https://example.com/a//b/..", want: "https://example.com/a//"},
+		{name: "trailing slash kept", cz: def, in: "https://example.com/docs/", want: "https://example.com/docs/"},
+		{name: "trailing slash folded", cz: fold, in: "https://example.com/docs/", want: "https://example.com/docs"},
+		{name: "root slash not folded", cz: fold, in: "https://example.com/", want: "https://example.com/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.cz.apply(u).String(); got != tt.want {
+				t.Errorf("apply(%s) = %s, want %s", tt.in, got, tt.want)
+			}
+			if u.String() != tt.in {
+				t.Errorf("apply modified its argument: %s", u)
+			}
+		})
+	}
+}
+
+func TestCrawlFetchesOriginalURL(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.RequestURI())
+		mu.Unlock()
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/" {
+			// Две записи одной страницы: запросится первая, как она есть
+			fmt.Fprint(w, `<a href="/list?page=2&sort=asc&utm_source=x">one</a><a href="/list?sort=asc&page=2">two</a>`+
+				`<a href="/shop;jsessionid=S1?b=1&a=2">shop</a>`)
+			return
+		}
+		fmt.Fprint(w, `<p>page</p>`)
+	}))
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL + "/")
+	store := NewMemoryStorage()
+	c, err := NewCrawler(Config{BaseURL: base, Storage: store, MaxDepth: 1, Concurrency: 1, Canonical: DefaultCanonicalization()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(requests)
+	want := []string{"/", "/list?page=2&sort=asc&utm_source=x", "/shop;jsessionid=S1?b=1&a=2"}
+	if fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+
+	// Обе записи ссылки ведут на один сохраненный файл
+	host := strings.ReplaceAll(base.Host, ":", "_")
+	index, _ := store.ReadFile(host + "/index.html")
+	var hrefs []string
+	for _, part := range strings.Split(string(index), `href="`)[1:] {
+		href, _, _ := strings.Cut(part, `"`)
+		hrefs = append(hrefs, href)
+	}
+	if len(hrefs) != 3 || hrefs[0] != hrefs[1] || strings.HasPrefix(hrefs[0], "http") {
+		t.Errorf("links not converted to one local file: %v", hrefs)
+	}
+
+	// Манифест называет запрошенные URL; канонический ключ — отдельным полем
+	var urls []string
+	for _, e := range c.manifestEntries() {
+		urls = append(urls, strings.TrimPrefix(e.URL, srv.URL))
+		if e.URL == srv.URL+"/list?page=2&sort=asc&utm_source=x" && e.Canonical != srv.URL+"/list?page=2&sort=asc" {
+			t.Errorf("canonical key %q", e.Canonical)
+		}
+	}
+	if fmt.Sprint(urls) != fmt.Sprint(want) {
+		t.Errorf("manifest URLs = %v, want %v", urls, want)
+	}
+}
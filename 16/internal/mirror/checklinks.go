@@ -0,0 +1,95 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"time"
+)
+
+// BrokenLink — недоступная ссылка, найденная в режиме CheckLinks.
+type BrokenLink struct {
+	URL        string
+	HTTPStatus int // 0 — ответа не было (DNS, соединение, таймаут)
+	Error      string
+	Referrers  []string // страницы, где встречается ссылка
+}
+
+// checkTask проверяет URL вне обхода или ресурс, в котором не ищутся ссылки:
+// HEAD, при неудаче GET; тело не скачивается.
+func (c *Crawler) checkTask(ctx context.Context, t task) (urlOutcome, error) {
+	release, err := c.sched.acquire(ctx, t.URL.Host, 0)
+	if err != nil {
+		return urlOutcome{}, err
+	}
+	start := time.Now()
+	res, err := c.httpc.Check(ctx, t.URL.String())
+	release()
+	if err != nil {
+		return urlOutcome{}, err
+	}
+	c.metrics.fetched(res.StatusCode, time.Since(start), 0)
+	o := urlOutcome{
+		ContentType: res.ContentType,
+		Redirects:   res.Redirects,
+		HTTPStatus:  res.StatusCode,
+		FetchMs:     time.Since(start).Milliseconds(),
+	}
+	if res.FinalURL != t.URL.String() {
+		o.FinalURL = res.FinalURL
+	}
+	if res.StatusCode >= 400 {
+		se := &httpStatusError{code: res.StatusCode, retryAfter: c.cfg.Retry.retryAfter(res.Header)}
+		if se.retryAfter > 0 {
+			c.sched.backoff(t.URL.Host, time.Now().Add(se.retryAfter))
+		}
+		return o, se
+	}
+	return o, nil
+}
+
+// addReferrer запоминает, что ссылка на u найдена на странице page.
+func (c *Crawler) addReferrer(u, page *url.URL) {
+	key, ref := c.key(u), page.String()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !slices.Contains(c.referrers[key], ref) {
+		c.referrers[key] = append(c.referrers[key], ref)
+	}
+}
+
+// BrokenLinks возвращает ссылки, проверка которых закончилась ошибкой, по порядку URL.
+// Ссылка, которая редиректом ведет на недоступный URL, тоже недоступна.
+func (c *Crawler) BrokenLinks() []BrokenLink {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var out []BrokenLink
+	for k, o := range c.outcomes {
+		switch o.Status {
+		case outcomeFailed:
+		case outcomeRedirected:
+			// Итоговый URL проверялся отдельно — берем его итог
+			final, err := url.Parse(o.FinalURL)
+			if err != nil {
+				continue
+			}
+			fo, ok := c.outcomes[c.key(final)]
+			if !ok || fo.Status != outcomeFailed {
+				continue
+			}
+			o.HTTPStatus, o.Error = fo.HTTPStatus, fo.Error
+		default:
+			continue
+		}
+		b := BrokenLink{URL: o.requestedURL(k), HTTPStatus: o.HTTPStatus, Error: o.Error, Referrers: slices.Clone(c.referrers[k])}
+		if o.FinalURL != "" {
+			b.Error = fmt.Sprintf("%s (после редиректа на %s)", o.Error, o.FinalURL)
+		}
+		sort.Strings(b.Referrers)
+		out = append(out, b)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].URL < out[j].URL })
+	return out
+}
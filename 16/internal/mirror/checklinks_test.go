@@ -0,0 +1,107 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestCheckLinks(t *testing.T) {
+	ext := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/ok":
+		case r.URL.Path == "/get-only" && r.Method == http.MethodGet:
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ext.Close()
+
+	pages := map[string]string{
+		"/": `<a href="/a">a</a><a href="/gone">gone</a><img src="/missing.png"><img src="/logo.png">` +
+			`<a href="` + ext.URL + `/ok">ok</a><a href="` + ext.URL + `/get-only">get</a><a href="` + ext.URL + `/nope">nope</a>` +
+			// Не HTTP — проверять нечем, и это не битые ссылки
+			`<a href="tel:+123">tel</a><a href="ftp://example.com/file">ftp</a><a href="Mailto:a@example.com">mail</a>`,
+		// Отчет называет URL так, как он записан в ссылке, а не канонический ключ
+		"/a": `<a href="/gone">gone again</a><a href="/old">old</a><a href="/lost?utm_source=mail">lost</a>`,
+	}
+	var (
+		mu          sync.Mutex
+		logoMethods []string
+	)
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/old":
+			http.Redirect(w, r, "/gone", http.StatusMovedPermanently)
+			return
+		case "/logo.png":
+			mu.Lock()
+			logoMethods = append(logoMethods, r.Method)
+			mu.Unlock()
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "PNG")
+			return
+		}
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, body)
+	}))
+	defer site.Close()
+
+	base, _ := url.Parse(site.URL + "/")
+	out := t.TempDir()
+	c, err := NewCrawler(Config{
+		BaseURL:      base,
+		OutputDir:    out,
+		MaxDepth:     2,
+		Concurrency:  2,
+		SameHostOnly: true,
+		CheckLinks:   true,
+		Canonical:    DefaultCanonicalization(),
+		Retry:        RetryPolicy{MaxAttempts: 1},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := make(map[string][]string)
+	for _, b := range c.BrokenLinks() {
+		got[b.URL] = b.Referrers
+		if b.URL == site.URL+"/old" && b.Error != "HTTP 404 (после редиректа на "+site.URL+"/gone)" {
+			t.Errorf("error for redirect = %q", b.Error)
+		}
+	}
+	want := map[string][]string{
+		site.URL + "/gone":                 {site.URL + "/", site.URL + "/a"},
+		site.URL + "/missing.png":          {site.URL + "/"},
+		site.URL + "/old":                  {site.URL + "/a"},
+		site.URL + "/lost?utm_source=mail": {site.URL + "/a"},
+		ext.URL + "/nope":                  {site.URL + "/"},
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("broken links = %v, want %v", got, want)
+	}
+
+	// Картинка на сайте только проверяется, а не скачивается
+	if fmt.Sprint(logoMethods) != "[HEAD]" {
+		t.Errorf("logo.png requested with %v, want a single HEAD", logoMethods)
+	}
+
+	// Ничего не сохранено: в каталоге только пустой каталог временных файлов, и тот удален
+	entries, _ := os.ReadDir(out)
+	if len(entries) != 0 {
+		t.Errorf("check mode left files: %v", entries)
+	}
+}
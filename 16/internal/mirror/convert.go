@@ -0,0 +1,119 @@
+package mirror
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// convertLinks переписывает ссылки в сохраненных HTML и CSS на локальные пути, а ссылки
+// на несохраненное — на абсолютные URL (как wget -k).
+// Запускается после обхода: куда лег файл, известно только после его скачивания
+// (расширение по Content-Type, имя из Content-Disposition), и догадка по URL
+// при разборе страницы могла не совпасть с итоговым путем.
+func (c *Crawler) convertLinks() {
+	c.mu.Lock()
+	paths := make(map[string]string, len(c.outcomes))
+	var todo []string
+	for k, o := range c.outcomes {
+		if o.LocalPath != "" && (o.Status == outcomeSaved || o.Status == outcomeNotModified) {
+			paths[k] = o.LocalPath
+			// Ссылки на любой URL цепочки редиректов ведут туда, где лежит содержимое
+			c.mapAliases(paths, o, o.LocalPath)
+		}
+		if o.Status == outcomeSaved && o.Convert {
+			todo = append(todo, k)
+		}
+	}
+	// Редиректы на URL, скачанный отдельной задачей, — после того, как известны все пути
+	for k, o := range c.outcomes {
+		if o.Status != outcomeRedirected {
+			continue
+		}
+		if final, err := url.Parse(o.FinalURL); err == nil {
+			if p, ok := paths[c.key(final)]; ok {
+				paths[k] = p
+				c.mapAliases(paths, o, p)
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	// Локальными становятся только ссылки на сохраненные файлы; то, что за пределами
+	// глубины, запрещено robots, отфильтровано или не скачалось, ведет на живой сайт
+	pathFor := func(u *url.URL) (string, bool) {
+		p, ok := paths[c.key(u)]
+		return p, ok
+	}
+
+	converted := 0
+	for _, k := range todo {
+		c.mu.Lock()
+		o := c.outcomes[k]
+		c.mu.Unlock()
+		page := o.FinalURL
+		if page == "" {
+			page = o.requestedURL(k)
+		}
+		pageURL, err := url.Parse(page)
+		if err != nil {
+			continue
+		}
+		if err := c.convertFile(pageURL, o, pathFor); err != nil {
+			log.Printf("Ошибка преобразования ссылок в %s: %v", o.LocalPath, err)
+			continue
+		}
+		o.Convert = false
+		c.mu.Lock()
+		c.outcomes[k] = o
+		c.mu.Unlock()
+		if c.cache != nil {
+			c.cache.markConverted(k)
+		}
+		converted++
+	}
+	if converted > 0 {
+		log.Printf("Ссылки преобразованы в %d файлах", converted)
+	}
+}
+
+// mapAliases сопоставляет локальный путь итоговому и промежуточным URL редиректа.
+func (c *Crawler) mapAliases(paths map[string]string, o urlOutcome, localPath string) {
+	aliases := o.Redirects
+	if o.FinalURL != "" {
+		aliases = append(aliases[:len(aliases):len(aliases)], o.FinalURL)
+	}
+	for _, a := range aliases {
+		if u, err := url.Parse(a); err == nil {
+			if _, ok := paths[c.key(u)]; !ok {
+				paths[c.key(u)] = localPath
+			}
+		}
+	}
+}
+
+func (c *Crawler) convertFile(page *url.URL, o urlOutcome, pathFor pathLookup) error {
+	name := filepath.ToSlash(o.LocalPath)
+	rc, err := c.staging.Open(name)
+	if err != nil {
+		return err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	var out []byte
+	if isCSS(page, strings.ToLower(o.ContentType)) {
+		out, _ = rewriteCSSAndDiscover(page, o.LocalPath, data, pathFor)
+	} else {
+		out, _, err = rewriteHTMLAndDiscover(page, o.LocalPath, data, pathFor)
+		if err != nil {
+			return err
+		}
+	}
+	return c.store.Put(name, bytes.NewReader(out), int64(len(out)))
+}
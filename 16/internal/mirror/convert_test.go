@@ -0,0 +1,84 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestConvertLinksThroughRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/a">a</a> <a href="/b">b</a> <a href="/final/">final</a> <a href="/x">x</a> <img src="/old.png">`)
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/final/", http.StatusMovedPermanently)
+		case "/x":
+			http.Redirect(w, r, "/final/", http.StatusFound)
+		case "/old.png":
+			http.Redirect(w, r, "/img/new.png", http.StatusMovedPermanently)
+		case "/final/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<p>final</p>`)
+		case "/img/new.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "PNG")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL + "/")
+	store := NewMemoryStorage()
+	c, err := NewCrawler(Config{BaseURL: base, Storage: store, MaxDepth: 1, Concurrency: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	host := strings.ReplaceAll(base.Host, ":", "_")
+	want := []string{host + "/final/index.html", host + "/img/new.png", host + "/index.html"}
+	if got := store.Names(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("stored %v, want %v: one copy per redirect target", got, want)
+	}
+
+	// Ссылка на любой URL цепочки ведет туда, куда легло итоговое содержимое
+	index, _ := store.ReadFile(host + "/index.html")
+	for _, frag := range []string{
+		`<a href="final/index.html">a</a>`,
+		`<a href="final/index.html">b</a>`,
+		`<a href="final/index.html">final</a>`,
+		`<a href="final/index.html">x</a>`,
+		`<img src="img/new.png"/>`,
+	} {
+		if !strings.Contains(string(index), frag) {
+			t.Errorf("index.html lacks %s:\n%s", frag, index)
+		}
+	}
+
+	// Содержимое сохранено задачей, первой дошедшей до итогового URL; остальные URL
+	// цепочек учтены как перенаправленные
+	saved := 0
+	for k, o := range c.outcomes {
+		switch o.Status {
+		case outcomeSaved:
+			saved++
+		case outcomeRedirected:
+		default:
+			t.Errorf("%s: status %s", k, o.Status)
+		}
+	}
+	if saved != 3 {
+		t.Errorf("%d URLs saved, want 3", saved)
+	}
+}
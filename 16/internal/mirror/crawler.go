@@ -1,15 +1,33 @@
 package mirror
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Как часто сохранять состояние обхода на диск
+const stateSaveInterval = 5 * time.Second
+
+var (
+	// errSkipped — URL сознательно не скачан (robots.txt, другой хост и т.п.)
+	errSkipped = errors.New("skipped")
+	// errNotModified — сервер ответил 304, локальная копия актуальна
+	errNotModified = errors.New("not modified")
+	// errRedirected — редирект привел на URL, который уже скачан или стоит в очереди
+	errRedirected = errors.New("redirected to an already known URL")
+	// errBudget — исчерпан бюджет обхода (страницы или байты)
+	errBudget = fmt.Errorf("%w: исчерпан бюджет обхода", errSkipped)
 )
 
 type Crawler struct {
@@ -21,11 +39,39 @@ type Crawler struct {
 
 	base *url.URL
 
-	visitedMu sync.Mutex
-	visited   map[string]struct{}
+	// mu защищает visited и outcomes и делает "отметить посещенным + поставить в очередь"
+	// атомарным для снимка состояния
+	mu       sync.Mutex
+	visited  map[string]struct{}
+	outcomes map[string]urlOutcome
+
+	frontier *frontier
+	sched    *hostScheduler
+
+	scope      *crawlScope
+	urlFilter  *urlFilter
+	mimeFilter *mimeFilter
+	pages      atomic.Int64 // начатых страниц, для MaxPages
+	bytes      atomic.Int64 // скачанных байт, для MaxBytes
+
+	// валидаторы с прошлых запусков; nil, если Incremental выключен
+	cache *validatorCache
 
-	queue chan task
-	wg    sync.WaitGroup
+	// store — куда сохраняется зеркало; staging — где HTML и CSS ждут преобразования
+	// ссылок: само store, если его можно перечитать, иначе каталог внутри tmp
+	store   Storage
+	staging ReadableStorage
+	// tmp — каталог для скачиваемых потоком файлов; пусто — все тела читаются в память
+	tmp string
+
+	metrics *crawlMetrics
+
+	// referrers — все страницы, ссылающиеся на URL (только в режиме CheckLinks); под mu
+	referrers map[string][]string
+	// blobs — SHA-256 содержимого -> путь первой сохраненной копии (Config.Dedup); под mu
+	blobs map[string]string
+	// owners — путь в зеркале -> ключ URL, чье содержимое там лежит; под mu
+	owners map[string]string
 }
 
 func NewCrawler(cfg Config) (*Crawler, error) {
@@ -41,186 +87,671 @@ func NewCrawler(cfg Config) (*Crawler, error) {
 	if cfg.RequestTimeout <= 0 {
 		cfg.RequestTimeout = 20_000_000_000
 	}
+	if cfg.Retry.MaxAttempts <= 0 {
+		cfg.Retry = DefaultRetryPolicy()
+	}
+	// В WARC должен попасть полный ответ, а не 304 на условный запрос
+	if cfg.WARCPrefix != "" {
+		cfg.Incremental = false
+	}
+	// Проверка ссылок ничего не сохраняет, так что и продолжать ее не с чего
+	if cfg.CheckLinks {
+		cfg.Incremental, cfg.Resume = false, false
+	}
+	store := cfg.Storage
+	if store == nil {
+		store = NewFSStorage(cfg.OutputDir)
+	}
+	// Состояние и кэш валидаторов описывают каталог зеркала на диске;
+	// архив или память не продолжить и не обновить
+	if _, onDisk := store.(*FSStorage); !onDisk {
+		cfg.Incremental, cfg.Resume = false, false
+	}
+	// Для архива staging появится в Run вместе с временным каталогом
+	staging, _ := store.(ReadableStorage)
+	uf, err := newURLFilter(cfg.Include, cfg.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	var cache *validatorCache
+	if cfg.Incremental {
+		cache, err = loadValidatorCache(cfg.OutputDir)
+		if err != nil {
+			return nil, err
+		}
+	}
 	return &Crawler{
-		cfg:     cfg,
-		httpc:   NewHttpClient(cfg.RequestTimeout, cfg.UserAgent),
-		robots:  newRobotsManager(),
-		base:    cfg.BaseURL,
-		visited: make(map[string]struct{}),
-		queue:   make(chan task, cfg.Concurrency*4),
+		cfg:      cfg,
+		httpc:    NewHttpClient(cfg.RequestTimeout, cfg.UserAgent),
+		robots:   newRobotsManager(cfg.UserAgent),
+		base:     cfg.BaseURL,
+		visited:  make(map[string]struct{}),
+		outcomes: make(map[string]urlOutcome),
+		frontier: newFrontier(),
+		sched:    newHostScheduler(cfg.HostConcurrency, cfg.HostRPS),
+		cache:    cache,
+
+		scope:      newCrawlScope(cfg.BaseURL, cfg.SameHostOnly, cfg.AllowedDomains, cfg.PageRequisites),
+		urlFilter:  uf,
+		mimeFilter: newMIMEFilter(cfg.AllowMIME, cfg.DenyMIME),
+		metrics:    newCrawlMetrics(),
+		referrers:  make(map[string][]string),
+		blobs:      make(map[string]string),
+		owners:     make(map[string]string),
+		store:      store,
+		staging:    staging,
 	}, nil
 }
 
-func (c *Crawler) Run(ctx context.Context) error {
-	startKind := ResourcePage
-	startTask := task{
-		URL:       c.base,
-		DepthLeft: c.cfg.MaxDepth,
-		Kind:      startKind,
+// Run обходит сайт до опустошения очереди или отмены ctx. Состояние обхода периодически
+// сохраняется в OutputDir; с Config.Resume обход продолжается с сохраненного места.
+// При отмене возвращается ctx.Err(), состояние при этом сохранено.
+func (c *Crawler) Run(ctx context.Context) (err error) {
+	if err := c.makeTmpDir(); err != nil {
+		return err
+	}
+	if c.tmp != "" {
+		defer os.RemoveAll(c.tmp)
+	}
+	// Страницы для архива ждут конца обхода на диске, а не в памяти: на большом сайте
+	// их не уместить в память
+	if c.staging == nil {
+		c.staging = NewFSStorage(filepath.Join(c.tmp, "staging"))
+	}
+
+	if c.cfg.WARCPrefix != "" {
+		robots := "ignore"
+		if c.cfg.RespectRobots {
+			robots = "obey"
+		}
+		ww := newWARCWriter(c.cfg.WARCPrefix, c.cfg.WARCMaxSize, warcInfoFields(
+			"software", "site-mirror/1.0",
+			"format", "WARC File Format 1.1",
+			"conformsTo", "https://iipc.github.io/warc-specifications/specifications/warc-format/warc-1.1/",
+			"isPartOf", c.base.String(),
+			"robots", robots,
+			"http-header-user-agent", c.cfg.UserAgent,
+		))
+		c.httpc.archiveTo(ww, c.tmp)
+		defer func() {
+			if werr := ww.close(); werr != nil && err == nil {
+				err = fmt.Errorf("WARC: %w", werr)
+			}
+		}()
+	}
+
+	resumed := false
+	if c.cfg.Resume {
+		resumed, err = c.loadState()
+		if err != nil {
+			return err
+		}
+		if resumed {
+			log.Printf("Продолжаем обход: в очереди %d URL", len(c.frontier.snapshot()))
+		}
+	}
+	if !resumed {
+		startTask := task{
+			URL:       c.base,
+			DepthLeft: c.cfg.MaxDepth,
+			Kind:      ResourcePage,
+		}
+		c.enqueue(startTask)
+		if c.cfg.Sitemaps {
+			c.seedFromSitemaps(ctx)
+		}
 	}
-	c.markVisited(startTask.URL)
-	c.wg.Add(1)
+
+	// Периодическое сохранение состояния
+	saverDone := make(chan struct{})
+	stopSaver := make(chan struct{})
 	go func() {
-		defer c.wg.Done()
-		c.queue <- startTask
+		defer close(saverDone)
+		ticker := time.NewTicker(stateSaveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopSaver:
+				return
+			case <-ticker.C:
+				if !c.persistent() {
+					continue
+				}
+				if err := c.saveState(); err != nil {
+					log.Printf("Ошибка сохранения состояния: %v", err)
+				}
+				if err := c.saveCache(); err != nil {
+					log.Printf("Ошибка сохранения кэша валидаторов: %v", err)
+				}
+			}
+		}
 	}()
 
+	// Бюджет по времени: по истечении воркеры останавливаются, как при прерывании,
+	// и незавершенные задачи остаются в состоянии для -resume
+	crawlCtx := ctx
+	if c.cfg.MaxDuration > 0 {
+		var cancel context.CancelFunc
+		crawlCtx, cancel = context.WithTimeout(ctx, c.cfg.MaxDuration)
+		defer cancel()
+	}
+
+	if c.cfg.MetricsAddr != "" {
+		stopMetrics, err := c.startMetricsServer()
+		if err != nil {
+			return err
+		}
+		defer stopMetrics()
+	}
+
 	// Старт воркеров
+	stopProgress := func() {}
+	if c.cfg.Progress {
+		stopProgress = c.startProgress()
+	}
+	var wg sync.WaitGroup
 	for i := 0; i < c.cfg.Concurrency; i++ {
-		c.wg.Add(1)
+		wg.Add(1)
 		go func(id int) {
-			defer c.wg.Done()
-			c.worker(ctx, id)
+			defer wg.Done()
+			c.worker(crawlCtx, id)
 		}(i + 1)
 	}
+	wg.Wait()
+	stopProgress()
+	close(stopSaver)
+	<-saverDone
+	if crawlCtx.Err() != nil && ctx.Err() == nil {
+		if c.persistent() {
+			log.Printf("Достигнут лимит времени обхода (%v); продолжить можно с флагом -resume", c.cfg.MaxDuration)
+		} else {
+			log.Printf("Достигнут лимит времени обхода (%v), обход не завершен", c.cfg.MaxDuration)
+		}
+	}
+	// Ссылки преобразуются только по окончании обхода: до этого не все пути известны.
+	// Прерванный обход на диске продолжится с -resume, а другие хранилища не продолжить —
+	// в них преобразуем то, что успели скачать
+	if !c.cfg.CheckLinks && (crawlCtx.Err() == nil || !c.persistent()) {
+		c.convertLinks()
+	}
 
-	// Ожидание завершения
-	go func() {
-		c.wg.Wait()
-		close(c.queue) // чтобы воркеры исчерпали
-	}()
+	if c.persistent() {
+		if err := c.saveState(); err != nil {
+			return fmt.Errorf("сохранение состояния: %w", err)
+		}
+		if err := c.saveCache(); err != nil {
+			return fmt.Errorf("сохранение кэша валидаторов: %w", err)
+		}
+	}
+	if err := c.writeManifest(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
 
-	// Дожидаемся опустошения канала
-	for range c.queue {
-		// worker сам вернет задачи, мы здесь просто поддерживаем блокировку до завершения
+func (c *Crawler) saveCache() error {
+	if c.cache == nil {
+		return nil
 	}
-	return nil
+	return c.cache.save()
 }
 
 func (c *Crawler) worker(ctx context.Context, id int) {
 	for {
-		select {
-		case <-ctx.Done():
+		t, ok := c.frontier.pop(ctx)
+		if !ok {
 			return
-		case t, ok := <-c.queue:
-			if !ok {
-				return
-			}
-			if err := c.processTask(ctx, t); err != nil {
-				log.Printf("[worker %d] Ошибка обработки %s: %v", id, t.URL, err)
-			}
 		}
+		o, err := c.processTask(ctx, *t)
+
+		// Прерванная отменой задача остается в очереди для -resume
+		if err != nil && ctx.Err() != nil {
+			c.frontier.requeue(t)
+			continue
+		}
+		if delay, ok := c.cfg.Retry.retryDelay(t.Attempt+1, err); ok {
+			log.Printf("[worker %d] %s: %v, повтор %d/%d через %v", id, t.URL, err, t.Attempt+2, c.cfg.Retry.MaxAttempts, delay.Round(time.Millisecond))
+			c.frontier.retry(t, delay)
+			continue
+		}
+		if err != nil && !errors.Is(err, errSkipped) && !errors.Is(err, errNotModified) && !errors.Is(err, errRedirected) {
+			log.Printf("[worker %d] Ошибка обработки %s: %v", id, t.URL, err)
+		}
+		c.finish(t, o, err)
 	}
 }
 
-func (c *Crawler) processTask(ctx context.Context, t task) error {
+// finish записывает итог обработки URL и снимает задачу из очереди.
+func (c *Crawler) finish(t *task, o urlOutcome, err error) {
+	o.Status = outcomeSaved
+	switch {
+	case errors.Is(err, errSkipped):
+		o = urlOutcome{Status: outcomeSkipped, Error: err.Error()}
+	case errors.Is(err, errNotModified):
+		o.Status = outcomeNotModified
+	case errors.Is(err, errRedirected):
+		o.Status = outcomeRedirected
+	case err != nil:
+		o.Status, o.Error = outcomeFailed, err.Error()
+	}
+	o.URL = t.URL.String()
+	o.Attempts = t.Attempt + 1
+	c.metrics.finished(o.Status)
+	o.Depth = c.cfg.MaxDepth - t.DepthLeft
+	if t.From != nil {
+		o.From = t.From.String()
+	}
+	c.mu.Lock()
+	c.outcomes[c.key(t.URL)] = o
+	c.ownPath(c.key(t.URL), o)
+	c.frontier.done(t)
+	c.mu.Unlock()
+}
+
+// processTask скачивает URL и сохраняет его; в итоге заполнены путь относительно OutputDir
+// и сведения об ответе, статус проставляет finish.
+// Пропущенные URL возвращают ошибку, обернутую в errSkipped, неизменившиеся — errNotModified.
+func (c *Crawler) processTask(ctx context.Context, t task) (urlOutcome, error) {
 	// robots.txt
 	if c.cfg.RespectRobots {
-		if !c.robots.allowed(t.URL, func(robotsURL string) ([]byte, error) {
-			res, err := c.httpc.GetText(ctx, robotsURL, 1<<20)
-			if err != nil {
-				return nil, err
-			}
-			return res.Body, nil
-		}) {
+		ok, err := c.robots.allowed(t.URL, c.robotsFetcher(ctx))
+		if err != nil {
+			return urlOutcome{}, err
+		}
+		if !ok {
 			log.Printf("robots.txt запретил: %s", t.URL)
-			return nil
+			return urlOutcome{}, fmt.Errorf("%w: robots.txt", errSkipped)
 		}
 	}
 
-	// same-host-only
-	if c.cfg.SameHostOnly && !sameHost(c.base, t.URL) {
-		return nil
+	if t.CheckOnly {
+		return c.checkTask(ctx, t)
+	}
+
+	if !c.scope.allowed(t.URL, t.Kind) {
+		return urlOutcome{}, fmt.Errorf("%w: хост вне области обхода", errSkipped)
+	}
+
+	// Бюджеты: страницу засчитываем до загрузки (повторные попытки — не заново),
+	// чтобы параллельные воркеры не перебрали лимит
+	if c.cfg.MaxBytes > 0 && c.bytes.Load() >= c.cfg.MaxBytes {
+		return urlOutcome{}, errBudget
+	}
+	if t.Kind == ResourcePage && t.Attempt == 0 && c.cfg.MaxPages > 0 && c.pages.Add(1) > int64(c.cfg.MaxPages) {
+		return urlOutcome{}, errBudget
 	}
 
-	res, err := c.httpc.Get(ctx, t.URL.String())
+	// Ключ кэша — исходный URL задачи: t.URL ниже сменится на итоговый после редиректов
+	cacheKey := c.key(t.URL)
+	var cached cacheEntry
+	hasCached := false
+	if c.cache != nil {
+		cached, hasCached = c.cache.lookup(cacheKey, c.cfg.OutputDir)
+	}
+
+	// Sitemap говорит, что страница не менялась с прошлого скачивания — даже не запрашиваем
+	if hasCached && cached.unchangedSince(t.Lastmod) {
+		for _, dl := range cached.discoveredLinks() {
+			c.enqueueIfNew(dl, t)
+		}
+		return urlOutcome{LocalPath: cached.LocalPath, Size: cached.Size, SHA256: cached.SHA256}, errNotModified
+	}
+
+	// Вежливость: лимит соединений и частоты запросов к хосту, Crawl-delay из robots.txt
+	var crawlDelay time.Duration
+	if c.cfg.RespectRobots {
+		crawlDelay = c.robots.crawlDelay(t.URL, c.robotsFetcher(ctx))
+	}
+	release, err := c.sched.acquire(ctx, t.URL.Host, crawlDelay)
 	if err != nil {
-		return err
+		return urlOutcome{}, err
+	}
+	start := time.Now()
+	res, err := c.httpc.Get(ctx, t.URL.String(), GetOptions{
+		Validators: cached.validators(),
+		MaxSize:    c.cfg.MaxFileSize,
+		TempDir:    c.tmp,
+		InMemory:   func(ct string) bool { return c.tmp == "" || needsRewrite(t, ct) },
+		Accept:     c.mimeFilter.allowed,
+		Discard:    c.cfg.CheckLinks,
+	})
+	release()
+	if err != nil {
+		return urlOutcome{}, err
+	}
+	c.bytes.Add(res.Size)
+	c.metrics.fetched(res.StatusCode, time.Since(start), res.Size)
+	o := urlOutcome{
+		ContentType: res.ContentType,
+		Redirects:   res.Redirects,
+		HTTPStatus:  res.StatusCode,
+		Size:        res.Size,
+		SHA256:      res.SHA256,
+		FetchMs:     time.Since(start).Milliseconds(),
+	}
+	if res.FinalURL != t.URL.String() {
+		o.FinalURL = res.FinalURL
+	}
+	// Временный файл либо переименуется в итоговый, либо должен быть удален
+	defer func() {
+		if res.TempFile != "" {
+			os.Remove(res.TempFile)
+		}
+	}()
+	// 304: файл не трогаем, но ссылки обходим заново — за ними могли появиться изменения
+	if res.StatusCode == http.StatusNotModified && hasCached {
+		for _, dl := range cached.discoveredLinks() {
+			c.enqueueIfNew(dl, t)
+		}
+		o.LocalPath, o.Size, o.SHA256 = cached.LocalPath, cached.Size, cached.SHA256
+		return o, errNotModified
 	}
 	if res.StatusCode >= 400 {
-		return fmt.Errorf("HTTP %d", res.StatusCode)
+		se := &httpStatusError{code: res.StatusCode, retryAfter: c.cfg.Retry.retryAfter(res.Header)}
+		if se.retryAfter > 0 {
+			c.sched.backoff(t.URL.Host, time.Now().Add(se.retryAfter))
+		}
+		return o, se
 	}
 
-	finalURL, err := url.Parse(res.FinalURL)
-	if err == nil {
+	if finalURL, err := url.Parse(res.FinalURL); err == nil && o.FinalURL != "" {
+		// Итоговый URL уже в обходе — вторая копия не нужна: ссылки на исходный URL
+		// convertLinks направит туда, куда ляжет итоговый
+		if c.key(finalURL) != c.key(t.URL) && !c.claimRedirect(finalURL, res.Redirects) {
+			return o, errRedirected
+		}
+		// Ссылки разрешаются относительно настоящего адреса, а не канонического
 		t.URL = finalURL
 	}
-
-	// Вычисляем локальный путь (относительный к OutputDir)
-	localPath := localPathForURL(t.URL)
-	absPath := filepath.Join(c.cfg.OutputDir, localPath)
-	if err := os.MkdirAll(filepath.Dir(absPath), 0o755); err != nil {
-		return err
+	if c.cfg.WARCOnly || c.cfg.CheckLinks {
+		if needsRewrite(t, res.ContentType) {
+			links, _, _ := c.discoverLinks(t, res)
+			for _, dl := range links {
+				c.enqueueIfNew(dl, t)
+			}
+		}
+		return o, nil
 	}
 
-	ct := strings.ToLower(res.ContentType)
+	// Путь выбирается по фактическому ответу: /api/logo с image/png -> api/logo.png
+	name := c.claimPath(cacheKey, t.URL, filepath.ToSlash(localPathFor(t.URL, res.ContentType, res.Header.Get("Content-Disposition"))))
+	o.LocalPath = filepath.FromSlash(name)
 
-	// HTML
-	if t.Kind == ResourcePage || strings.Contains(ct, "text/html") {
-		rewritten, links, err := rewriteHTMLAndDiscover(t.URL, localPath, res.Body, c.cfg.SameHostOnly)
-		if err != nil {
-			// на всякий случай сохраняем оригинал
-			if writeErr := os.WriteFile(absPath, res.Body, 0o644); writeErr != nil {
-				log.Printf("Ошибка сохранения %s: %v", absPath, writeErr)
+	// Остальное, кроме HTML и CSS, сохраняется сразу; скачанное потоком — переносом файла
+	if !needsRewrite(t, res.ContentType) {
+		if first, ok := c.firstCopy(res.SHA256, name); ok {
+			o.DuplicateOf = filepath.FromSlash(first)
+			if l, ok := c.store.(linker); !ok || l.Link(first, name) != nil {
+				// Хранилище не умеет ссылки на файлы — страницы будут ссылаться на первую копию
+				o.LocalPath = o.DuplicateOf
 			}
-			return err
+			c.storeValidators(cacheKey, res, o.LocalPath, false, nil)
+			return o, nil
 		}
-		if err := os.WriteFile(absPath, rewritten, 0o644); err != nil {
-			return err
+		if res.TempFile != "" {
+			err = c.store.PutFile(name, res.TempFile)
+		} else {
+			err = c.store.Put(name, bytes.NewReader(res.Body), res.Size)
 		}
-
-		for _, dl := range links {
-			c.enqueueIfNew(dl, t.DepthLeft)
+		if err != nil {
+			return urlOutcome{}, err
 		}
-		return nil
+		res.TempFile = ""
+		c.addBlob(res.SHA256, name)
+		c.storeValidators(cacheKey, res, o.LocalPath, false, nil)
+		return o, nil
 	}
 
-	// CSS: переписываем url(...)
-	if strings.Contains(ct, "text/css") || strings.HasSuffix(strings.ToLower(t.URL.Path), ".css") {
-		rewritten, cssLinks := rewriteCSSAndDiscover(t.URL, localPath, res.Body, c.cfg.SameHostOnly)
-		if err := os.WriteFile(absPath, rewritten, 0o644); err != nil {
+	links, canonical, discoverErr := c.discoverLinks(t, res)
+	if canonical != nil && c.cfg.Canonical.RelCanonical && c.claimCanonical(t.URL, canonical) {
+		o.FinalURL = canonical.String()
+		return o, errRedirected
+	}
+
+	// HTML и CSS сохраняем как скачаны: ссылки в них переписывает convertLinks
+	// после обхода, когда известно, куда легли все файлы
+	if err := c.staging.Put(name, bytes.NewReader(res.Body), res.Size); err != nil {
+		return urlOutcome{}, err
+	}
+	if discoverErr != nil {
+		return o, discoverErr
+	}
+	// Реквизит со стороннего хоста дальше не обходим; только CSS тянет свои шрифты и картинки
+	if !c.scope.pageAllowed(t.URL) && !isCSS(t.URL, strings.ToLower(res.ContentType)) {
+		links = nil
+	}
+	o.Convert = true
+	c.storeValidators(cacheKey, res, o.LocalPath, true, links)
+	for _, dl := range links {
+		c.enqueueIfNew(dl, t)
+	}
+	return o, nil
+}
+
+// discoverLinks находит ссылки в HTML или CSS из тела ответа; для HTML возвращает
+// и URL из <link rel="canonical">.
+func (c *Crawler) discoverLinks(t task, res *FetchResult) ([]discoveredLink, *url.URL, error) {
+	localPath := localPathForURL(t.URL)
+	if isCSS(t.URL, strings.ToLower(res.ContentType)) {
+		_, links := rewriteCSSAndDiscover(t.URL, localPath, res.Body, nil)
+		return links, nil, nil
+	}
+	r := newLinkRewriter(t.URL, localPath, nil)
+	_, err := r.html(res.Body)
+	return r.found, r.canonical, err
+}
+
+// needsRewrite решает, держать ли тело в памяти: переписываются только HTML и CSS.
+// Без Content-Type судим по виду задачи и расширению.
+func needsRewrite(t task, contentType string) bool {
+	ct := strings.ToLower(contentType)
+	if isCSS(t.URL, ct) || strings.Contains(ct, "text/html") || strings.Contains(ct, "application/xhtml+xml") {
+		return true
+	}
+	return ct == "" && t.Kind == ResourcePage && isHTMLLikeByPath(t.URL)
+}
+
+func isCSS(u *url.URL, ct string) bool {
+	if strings.Contains(ct, "text/css") {
+		return true
+	}
+	return !strings.Contains(ct, "html") && strings.HasSuffix(strings.ToLower(u.Path), ".css")
+}
+
+// makeTmpDir готовит каталог для скачиваемых потоком файлов. Для зеркала на диске это
+// каталог внутри OutputDir (та же ФС — перенос на место атомарен), для архива —
+// системный временный (в нем же ждут преобразования ссылок страницы), а в памяти
+// файлы не пишутся вовсе (разве что спул WARC).
+func (c *Crawler) makeTmpDir() error {
+	var err error
+	switch c.store.(type) {
+	case *FSStorage:
+		c.tmp = filepath.Join(c.cfg.OutputDir, ".site-mirror-tmp")
+		// Остатки прерванных загрузок не нужны: файлы скачиваются заново
+		if err := os.RemoveAll(c.tmp); err != nil {
 			return err
 		}
-		for _, dl := range cssLinks {
-			c.enqueueIfNew(dl, t.DepthLeft)
+		return os.MkdirAll(c.tmp, 0o755)
+	case *MemoryStorage:
+		if c.cfg.WARCPrefix == "" {
+			return nil
 		}
-		return nil
 	}
+	c.tmp, err = os.MkdirTemp("", "site-mirror-")
+	return err
+}
 
-	// Бинарные ассеты: сохраняем как есть
-	if err := os.WriteFile(absPath, res.Body, 0o644); err != nil {
-		return err
+// persistent — обход оставляет на диске состояние и кэш, по которым его можно продолжить.
+func (c *Crawler) persistent() bool {
+	_, onDisk := c.store.(*FSStorage)
+	return onDisk && !c.cfg.CheckLinks
+}
+
+func (c *Crawler) robotsFetcher(ctx context.Context) fetchText {
+	return func(robotsURL string) (int, []byte, error) {
+		res, err := c.httpc.GetText(ctx, robotsURL, 1<<20)
+		if err != nil {
+			return 0, nil, err
+		}
+		return res.StatusCode, res.Body, nil
+	}
+}
+
+func (c *Crawler) storeValidators(key string, res *FetchResult, localPath string, raw bool, links []discoveredLink) {
+	if c.cache != nil {
+		c.cache.store(key, res, localPath, raw, links)
 	}
-	return nil
 }
 
-func (c *Crawler) enqueueIfNew(dl discoveredLink, parentDepth int) {
+// enqueueIfNew ставит в очередь найденную ссылку. Запрашивается URL в том виде, в каком
+// он указан на странице: канонический вид — только ключ, по которому узнаются копии.
+// Порядок параметров и сессионные параметры бывают важны серверу.
+func (c *Crawler) enqueueIfNew(dl discoveredLink, parent task) {
 	// Глубина: для страниц уменьшаем, для ассетов — нет
-	depthLeft := parentDepth
+	depthLeft := parent.DepthLeft
 	if dl.Kind == ResourcePage {
-		depthLeft = parentDepth - 1
+		depthLeft--
 	}
-	if depthLeft < 0 {
+	if !isHTTPURL(dl.URL) {
 		return
 	}
-	// same-host-only
-	if c.cfg.SameHostOnly && !sameHost(c.base, dl.URL) {
+	crawl := depthLeft >= 0 && c.scope.allowed(dl.URL, dl.Kind)
+	// При проверке ссылок URL вне обхода не скачиваются, но проверяются
+	if !crawl && !c.cfg.CheckLinks {
 		return
 	}
-	// dedup
-	if !c.markVisited(dl.URL) {
+	if !c.urlFilter.allowed(dl.URL, dl.Kind) {
 		return
 	}
+	checkOnly := !crawl
+	if c.cfg.CheckLinks {
+		c.addReferrer(dl.URL, parent.URL)
+		// Ссылки ищутся только в страницах и CSS; остальным ресурсам хватает HEAD
+		if dl.Kind == ResourceAsset && !isCSS(dl.URL, "") {
+			checkOnly = true
+		}
+	}
+	c.enqueue(task{URL: dl.URL, DepthLeft: max(depthLeft, 0), Kind: dl.Kind, From: parent.URL, CheckOnly: checkOnly})
+}
 
-	c.wg.Add(1)
-	go func() {
-		defer c.wg.Done()
-		select {
-		case c.queue <- task{URL: dl.URL, DepthLeft: depthLeft, Kind: dl.Kind}:
-		default:
-			// если очередь заполнена, блокирующая отправка
-			c.queue <- task{URL: dl.URL, DepthLeft: depthLeft, Kind: dl.Kind}
+// claimRedirect отмечает посещенными промежуточные URL редиректа и итоговый URL, чтобы
+// их не скачивать повторно. false — итоговый URL уже был в обходе.
+func (c *Crawler) claimRedirect(final *url.URL, hops []string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, h := range hops {
+		if u, err := url.Parse(h); err == nil {
+			c.visited[c.key(u)] = struct{}{}
 		}
-	}()
+	}
+	key := c.key(final)
+	if _, ok := c.visited[key]; ok {
+		return false
+	}
+	c.visited[key] = struct{}{}
+	return true
+}
+
+// claimCanonical решает, считать ли страницу копией URL из ее rel=canonical. Если
+// канонический URL уже в обходе — да. Иначе сохраняется эта страница, а канонический
+// URL отмечается ее псевдонимом, чтобы не скачивать его отдельно.
+func (c *Crawler) claimCanonical(page, canonical *url.URL) bool {
+	if !c.scope.pageAllowed(canonical) {
+		return false
+	}
+	key := c.key(canonical)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if key == c.key(page) {
+		return false
+	}
+	if _, ok := c.visited[key]; ok {
+		// Канонический URL сам оказался копией — не даем двум страницам сослаться друг на друга
+		if prior, ok := c.outcomes[key]; ok && prior.Status == outcomeRedirected {
+			return false
+		}
+		return true
+	}
+	c.visited[key] = struct{}{}
+	c.outcomes[key] = urlOutcome{URL: canonical.String(), Status: outcomeRedirected, FinalURL: page.String()}
+	return false
+}
+
+// firstCopy ищет уже сохраненный файл с тем же содержимым. HTML и CSS не сравниваются:
+// после преобразования ссылок одинаковые страницы по разным адресам могут разойтись.
+func (c *Crawler) firstCopy(sum, name string) (string, bool) {
+	if !c.cfg.Dedup || sum == "" {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	first, ok := c.blobs[sum]
+	return first, ok && first != name
+}
+
+// addBlob запоминает сохраненный файл. Копия регистрируется только после записи,
+// чтобы дубликаты не сослались на файл, которого так и не оказалось в хранилище.
+func (c *Crawler) addBlob(sum, name string) {
+	if !c.cfg.Dedup || sum == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.blobs[sum]; !ok {
+		c.blobs[sum] = name
+	}
+}
+
+// claimPath закрепляет путь name за URL с ключом key. Если путь уже занят другим URL
+// (одно имя из Content-Disposition у /dl/1 и /dl/2, /a и /a/), к имени добавляется
+// суффикс из URL — так же, как _q_ для query.
+func (c *Crawler) claimPath(key string, u *url.URL, name string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := 0; ; i++ {
+		p := name
+		if i > 0 {
+			p = withNameSuffix(name, urlSuffix(u, i))
+		}
+		if owner, ok := c.owners[p]; !ok || owner == key {
+			c.owners[p] = key
+			return p
+		}
+	}
+}
+
+// ownPath отмечает путь сохраненного URL занятым: пути из кэша и файла состояния
+// не проходят через claimPath. Копия, оставшаяся ссылкой на первый файл, путь не занимает.
+func (c *Crawler) ownPath(key string, o urlOutcome) {
+	if o.LocalPath == "" || o.LocalPath == o.DuplicateOf || (o.Status != outcomeSaved && o.Status != outcomeNotModified) {
+		return
+	}
+	name := filepath.ToSlash(o.LocalPath)
+	if _, ok := c.owners[name]; !ok {
+		c.owners[name] = key
+	}
+}
+
+// canon приводит URL к каноническому виду по Config.Canonical. Канонический вид служит
+// только для сравнения URL; запрашиваются и разрешают ссылки исходные URL.
+func (c *Crawler) canon(u *url.URL) *url.URL {
+	return c.cfg.Canonical.apply(u)
+}
+
+// key — ключ URL в visited и outcomes.
+func (c *Crawler) key(u *url.URL) string {
+	return urlKey(c.canon(u))
 }
 
-func (c *Crawler) markVisited(u *url.URL) bool {
-	key := urlKey(u)
-	c.visitedMu.Lock()
-	defer c.visitedMu.Unlock()
+// enqueue ставит задачу в очередь, если URL еще не встречался.
+func (c *Crawler) enqueue(t task) bool {
+	key := c.key(t.URL)
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	if _, ok := c.visited[key]; ok {
 		return false
 	}
 	c.visited[key] = struct{}{}
+	c.frontier.push(t)
 	return true
 }
@@ -0,0 +1,188 @@
+package mirror
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// urlFilter — правила include/exclude для пути и query URL.
+// Правило — glob ("*" — любая последовательность, "?" — один символ; сравнивается
+// с путем целиком вместе с query) или регулярное выражение с префиксом "re:" (ищется подстрока).
+type urlFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+func newURLFilter(include, exclude []string) (*urlFilter, error) {
+	f := &urlFilter{}
+	for _, r := range include {
+		re, err := compileURLRule(r)
+		if err != nil {
+			return nil, err
+		}
+		f.include = append(f.include, re)
+	}
+	for _, r := range exclude {
+		re, err := compileURLRule(r)
+		if err != nil {
+			return nil, err
+		}
+		f.exclude = append(f.exclude, re)
+	}
+	return f, nil
+}
+
+func compileURLRule(rule string) (*regexp.Regexp, error) {
+	if expr, ok := strings.CutPrefix(rule, "re:"); ok {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("правило %q: %w", rule, err)
+		}
+		return re, nil
+	}
+	var sb strings.Builder
+	sb.WriteString("^")
+	for _, ch := range rule {
+		switch ch {
+		case '*':
+			sb.WriteString(".*")
+		case '?':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// allowed: exclude отсекает любые URL, а include ограничивает только страницы —
+// ассеты, нужные разрешенным страницам, скачиваются, где бы они ни лежали.
+func (f *urlFilter) allowed(u *url.URL, kind ResourceKind) bool {
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	for _, re := range f.exclude {
+		if re.MatchString(target) {
+			return false
+		}
+	}
+	if kind != ResourcePage || len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(target) {
+			return true
+		}
+	}
+	return false
+}
+
+// mimeFilter — списки разрешенных и запрещенных типов ("text/html", "image/*").
+type mimeFilter struct {
+	allow []string
+	deny  []string
+}
+
+func newMIMEFilter(allow, deny []string) *mimeFilter {
+	norm := func(in []string) []string {
+		var out []string
+		for _, s := range in {
+			if s = strings.ToLower(strings.TrimSpace(s)); s != "" {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return &mimeFilter{allow: norm(allow), deny: norm(deny)}
+}
+
+// allowed проверяет Content-Type. Без Content-Type судить не по чему — пропускаем.
+func (f *mimeFilter) allowed(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = strings.ToLower(strings.TrimSpace(contentType))
+	}
+	for _, p := range f.deny {
+		if matchMIME(p, mt) {
+			return false
+		}
+	}
+	if len(f.allow) == 0 {
+		return true
+	}
+	for _, p := range f.allow {
+		if matchMIME(p, mt) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchMIME(pattern, mt string) bool {
+	if pattern == "*/*" || pattern == mt {
+		return true
+	}
+	if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+		return strings.HasPrefix(mt, prefix+"/")
+	}
+	return false
+}
+
+// crawlScope решает, с каких хостов скачивать.
+type crawlScope struct {
+	base         *url.URL
+	sameHostOnly bool
+	domains      []string
+	requisites   bool
+}
+
+func newCrawlScope(base *url.URL, sameHostOnly bool, domains []string, requisites bool) *crawlScope {
+	s := &crawlScope{base: base, sameHostOnly: sameHostOnly, requisites: requisites}
+	for _, d := range domains {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			s.domains = append(s.domains, d)
+		}
+	}
+	return s
+}
+
+// pageAllowed — хост входит в область обхода: по нему ходим и за страницами.
+func (s *crawlScope) pageAllowed(u *url.URL) bool {
+	if sameHost(s.base, u) {
+		return true
+	}
+	if len(s.domains) > 0 {
+		host := strings.ToLower(u.Hostname())
+		for _, d := range s.domains {
+			if matchDomain(d, host) {
+				return true
+			}
+		}
+		return false
+	}
+	return !s.sameHostOnly
+}
+
+// allowed — URL можно скачать: хост в области обхода или это реквизит страницы.
+func (s *crawlScope) allowed(u *url.URL, kind ResourceKind) bool {
+	return s.pageAllowed(u) || (s.requisites && kind == ResourceAsset)
+}
+
+// matchDomain: "example.com" — только этот хост, "*.example.com" — он и все поддомены.
+func matchDomain(pattern, host string) bool {
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return host == suffix || strings.HasSuffix(host, "."+suffix)
+	}
+	return host == pattern
+}
@@ -0,0 +1,254 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestURLFilter(t *testing.T) {
+	f, err := newURLFilter([]string{"/docs/*"}, []string{"re:[?&]print=1", "*.zip"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		url     string
+		kind    ResourceKind
+		allowed bool
+	}{
+		{url: "https://example.com/docs/a.html", kind: ResourcePage, allowed: true},
+		{url: "https://example.com/blog/", kind: ResourcePage, allowed: false},
+		{url: "https://example.com/static/logo.png", kind: ResourceAsset, allowed: true},
+		{url: "https://example.com/docs/a.html?print=1", kind: ResourcePage, allowed: false},
+		{url: "https://example.com/docs/all.zip", kind: ResourceAsset, allowed: false},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := f.allowed(u, tt.kind); got != tt.allowed {
+			t.Errorf("allowed(%s) = %v, want %v", tt.url, got, tt.allowed)
+		}
+	}
+}
+
+func TestCrawlScope(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+	s := newCrawlScope(base, true, []string{"*.example.org", "docs.example.net"}, true)
+	tests := []struct {
+		url     string
+		kind    ResourceKind
+		allowed bool
+	}{
+		{url: "https://example.com/a", kind: ResourcePage, allowed: true},
+		{url: "https://example.org/a", kind: ResourcePage, allowed: true},
+		{url: "https://www.example.org/a", kind: ResourcePage, allowed: true},
+		{url: "https://badexample.org/a", kind: ResourcePage, allowed: false},
+		{url: "https://docs.example.net/a", kind: ResourcePage, allowed: true},
+		{url: "https://www.example.net/a", kind: ResourcePage, allowed: false},
+		{url: "https://cdn.example.io/app.css", kind: ResourceAsset, allowed: true},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := s.allowed(u, tt.kind); got != tt.allowed {
+			t.Errorf("allowed(%s) = %v, want %v", tt.url, got, tt.allowed)
+		}
+	}
+}
+
+func TestMIMEFilter(t *testing.T) {
+	f := newMIMEFilter([]string{"text/html", " Image/* "}, []string{"image/svg+xml"})
+	tests := []struct {
+		ct      string
+		allowed bool
+	}{
+		{ct: "text/html; charset=utf-8", allowed: true},
+		{ct: "IMAGE/PNG", allowed: true},
+		{ct: "image/svg+xml", allowed: false},
+		{ct: "application/pdf", allowed: false},
+		{ct: "", allowed: true},
+	}
+	for _, tt := range tests {
+		if got := f.allowed(tt.ct); got != tt.allowed {
+			t.Errorf("allowed(%q) = %v, want %v", tt.ct, got, tt.allowed)
+		}
+	}
+	if !newMIMEFilter(nil, nil).allowed("application/zip") {
+		t.Error("empty filter rejects content")
+	}
+}
+
+// filterTestServer отдает /, который ссылается на страницы /docs/ и /blog/,
+// картинку, PDF и архив; requests считает обращения к каждому пути.
+func filterTestServer(t *testing.T) (*httptest.Server, map[string]int, *sync.Mutex) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/docs/a">a</a><a href="/docs/b">b</a><a href="/blog/">blog</a>`+
+				`<img src="/static/logo.png"><a href="/files/report.pdf">pdf</a><a href="/files/all.zip">zip</a>`)
+		case "/docs/a", "/docs/b", "/blog/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<p>`+strings.Repeat("x", 100)+`</p>`)
+		case "/static/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "PNG")
+		case "/files/report.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+			fmt.Fprint(w, "%PDF")
+		case "/files/all.zip":
+			w.Header().Set("Content-Type", "application/zip")
+			fmt.Fprint(w, "PK")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv, requests, &mu
+}
+
+func TestCrawlFilters(t *testing.T) {
+	srv, requests, mu := filterTestServer(t)
+	base, _ := url.Parse(srv.URL + "/")
+	out := t.TempDir()
+	c, err := NewCrawler(Config{
+		BaseURL:     base,
+		OutputDir:   out,
+		MaxDepth:    2,
+		Concurrency: 1,
+		Include:     []string{"/", "/docs/*", "/files/*"},
+		Exclude:     []string{"*.zip"},
+		DenyMIME:    []string{"application/pdf"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	host := strings.ReplaceAll(base.Host, ":", "_")
+	var saved []string
+	filepath.WalkDir(filepath.Join(out, host), func(p string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			rel, _ := filepath.Rel(filepath.Join(out, host), p)
+			saved = append(saved, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	sort.Strings(saved)
+	// /blog/ не входит в include, zip исключен, PDF отсечен по типу; картинка — ассет,
+	// include на нее не действует
+	want := []string{"docs/a/index.html", "docs/b/index.html", "index.html", "static/logo.png"}
+	if fmt.Sprint(saved) != fmt.Sprint(want) {
+		t.Errorf("saved %v, want %v", saved, want)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// Отфильтрованные по URL не запрашиваются вовсе, по типу — запрашиваются, но не сохраняются
+	if requests["/blog/"] != 0 || requests["/files/all.zip"] != 0 {
+		t.Errorf("filtered URLs requested: %v", requests)
+	}
+	if requests["/files/report.pdf"] != 1 {
+		t.Errorf("pdf requested %d times, want 1", requests["/files/report.pdf"])
+	}
+	pdf, _ := url.Parse(srv.URL + "/files/report.pdf")
+	if o := c.outcomes[c.key(pdf)]; o.Status != outcomeSkipped {
+		t.Errorf("pdf outcome %+v, want skipped", o)
+	}
+}
+
+func TestCrawlBudgets(t *testing.T) {
+	pages := func(c *Crawler) (saved, skipped int) {
+		for _, o := range c.outcomes {
+			switch o.Status {
+			case outcomeSaved:
+				saved++
+			case outcomeSkipped:
+				skipped++
+			}
+		}
+		return saved, skipped
+	}
+
+	t.Run("max pages", func(t *testing.T) {
+		srv, _, _ := filterTestServer(t)
+		base, _ := url.Parse(srv.URL + "/")
+		c, err := NewCrawler(Config{BaseURL: base, Storage: NewMemoryStorage(), MaxDepth: 2, Concurrency: 2, MaxPages: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, o := range c.outcomes {
+			if o.Status == outcomeSaved && strings.HasSuffix(o.LocalPath, ".html") {
+				n++
+			}
+		}
+		if n != 2 {
+			t.Errorf("saved %d pages, want 2", n)
+		}
+	})
+
+	t.Run("max bytes", func(t *testing.T) {
+		srv, _, _ := filterTestServer(t)
+		base, _ := url.Parse(srv.URL + "/")
+		// Корневая страница уже больше бюджета: после нее ничего не скачивается
+		c, err := NewCrawler(Config{BaseURL: base, Storage: NewMemoryStorage(), MaxDepth: 2, Concurrency: 1, MaxBytes: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if saved, skipped := pages(c); saved != 1 || skipped == 0 {
+			t.Errorf("saved %d, skipped %d; want only the start page saved", saved, skipped)
+		}
+	})
+
+	t.Run("max duration", func(t *testing.T) {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			if r.URL.Path == "/" {
+				fmt.Fprint(w, `<a href="/slow">slow</a>`)
+				return
+			}
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}))
+		defer srv.Close()
+		base, _ := url.Parse(srv.URL + "/")
+		c, err := NewCrawler(Config{BaseURL: base, Storage: NewMemoryStorage(), MaxDepth: 1, Concurrency: 1, MaxDuration: 100 * time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		// Лимит времени — не ошибка обхода
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("crawl took %v despite 100ms budget", elapsed)
+		}
+		if saved, _ := pages(c); saved != 1 {
+			t.Errorf("saved %d, want 1", saved)
+		}
+	})
+}
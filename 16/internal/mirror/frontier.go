@@ -0,0 +1,174 @@
+package mirror
+
+import (
+	"cmp"
+	"container/heap"
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+// frontier — очередь задач краулера. В отличие от канала, ее содержимое можно
+// сохранить на диск: pending — еще не взятые задачи, inFlight — обрабатываемые сейчас.
+type frontier struct {
+	mu       sync.Mutex
+	cond     *sync.Cond
+	pending  taskHeap
+	inFlight map[*task]struct{}
+	// seq задает порядок задач, готовых одновременно: новые — в конец (обход в ширину),
+	// прерванные — в начало
+	last, first int64
+}
+
+// queuedTask — задача в очереди. ready — когда ее можно брать: момент постановки
+// или NotBefore, если он позже. Так отложенный повтор, срок которого подошел, не ждет
+// задачи, поставленные после этого срока.
+type queuedTask struct {
+	task
+	ready time.Time
+	seq   int64
+}
+
+// taskHeap — куча по (ready, seq): наверху всегда задача, которая освободится первой,
+// и pop не перебирает всю очередь.
+type taskHeap []queuedTask
+
+func (h taskHeap) Len() int { return len(h) }
+func (h taskHeap) Less(i, j int) bool {
+	if !h[i].ready.Equal(h[j].ready) {
+		return h[i].ready.Before(h[j].ready)
+	}
+	return h[i].seq < h[j].seq
+}
+func (h taskHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *taskHeap) Push(x any)   { *h = append(*h, x.(queuedTask)) }
+func (h *taskHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func newFrontier() *frontier {
+	f := &frontier{inFlight: make(map[*task]struct{})}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *frontier) push(t task) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.add(t)
+	f.cond.Signal()
+}
+
+// add ставит задачу в конец очереди; вызывается под f.mu.
+func (f *frontier) add(t task) {
+	f.last++
+	ready := time.Now()
+	if t.NotBefore.After(ready) {
+		ready = t.NotBefore
+	}
+	heap.Push(&f.pending, queuedTask{task: t, ready: ready, seq: f.last})
+}
+
+// pop ждет задачу, готовую к выполнению (отложенные повторы ждут своего NotBefore).
+// Возвращает false, когда очередь пуста и ничего не обрабатывается (обход завершен)
+// или отменен ctx.
+func (f *frontier) pop(ctx context.Context) (*task, bool) {
+	wake := func() {
+		f.mu.Lock()
+		f.cond.Broadcast()
+		f.mu.Unlock()
+	}
+	stop := context.AfterFunc(ctx, wake)
+	defer stop()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for {
+		if ctx.Err() != nil {
+			return nil, false
+		}
+		if len(f.pending) == 0 && len(f.inFlight) == 0 {
+			return nil, false
+		}
+
+		// Готовых нет: ждем новую задачу, завершения обработки или срока отложенной
+		if len(f.pending) == 0 {
+			f.cond.Wait()
+			continue
+		}
+		earliest := f.pending[0].ready
+		if !earliest.After(time.Now()) {
+			t := heap.Pop(&f.pending).(queuedTask).task
+			f.inFlight[&t] = struct{}{}
+			return &t, true
+		}
+		timer := time.AfterFunc(time.Until(earliest), wake)
+		f.cond.Wait()
+		timer.Stop()
+	}
+}
+
+// retry возвращает задачу в очередь для повтора не раньше, чем через delay.
+func (f *frontier) retry(t *task, delay time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.inFlight, t)
+	t.Attempt++
+	t.NotBefore = time.Now().Add(delay)
+	f.add(*t)
+	f.cond.Broadcast()
+}
+
+// done снимает задачу из обработки.
+func (f *frontier) done(t *task) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.inFlight, t)
+	if len(f.pending) == 0 && len(f.inFlight) == 0 {
+		f.cond.Broadcast()
+	}
+}
+
+// requeue возвращает прерванную задачу в начало очереди.
+func (f *frontier) requeue(t *task) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.inFlight, t)
+	f.first--
+	// Нулевое ready — раньше всех уже готовых: задача была взята, значит, ее срок прошел
+	heap.Push(&f.pending, queuedTask{task: *t, seq: f.first})
+	f.cond.Signal()
+}
+
+// snapshot возвращает все незавершенные задачи: обрабатываемые и ожидающие,
+// последние — в порядке очереди.
+func (f *frontier) snapshot() []task {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := make([]task, 0, len(f.inFlight)+len(f.pending))
+	for t := range f.inFlight {
+		out = append(out, *t)
+	}
+	pending := slices.Clone(f.pending)
+	slices.SortFunc(pending, func(a, b queuedTask) int {
+		if c := a.ready.Compare(b.ready); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.seq, b.seq)
+	})
+	for _, q := range pending {
+		out = append(out, q.task)
+	}
+	return out
+}
+
+// counts — число ожидающих и обрабатываемых задач.
+func (f *frontier) counts() (pending, inFlight int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.pending), len(f.inFlight)
+}
@@ -0,0 +1,85 @@
+package mirror
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestFrontierOrder(t *testing.T) {
+	f := newFrontier()
+	mk := func(p string) task {
+		u, _ := url.Parse("https://example.com" + p)
+		return task{URL: u}
+	}
+	pop := func() *task {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		got, ok := f.pop(ctx)
+		if !ok {
+			t.Fatal("pop: queue unexpectedly empty")
+		}
+		return got
+	}
+
+	f.push(mk("/a"))
+	f.push(mk("/b"))
+	a := pop()
+	if a.URL.Path != "/a" {
+		t.Fatalf("first pop = %s, want /a (FIFO)", a.URL.Path)
+	}
+
+	// Отложенный повтор не мешает готовым задачам
+	f.retry(a, 50*time.Millisecond)
+	f.push(mk("/c"))
+	if got := pop(); got.URL.Path != "/b" {
+		t.Errorf("pop = %s, want /b", got.URL.Path)
+	}
+	c := pop()
+	if c.URL.Path != "/c" {
+		t.Errorf("pop = %s, want /c", c.URL.Path)
+	}
+
+	// Прерванная задача возвращается в начало очереди
+	f.requeue(c)
+	f.push(mk("/d"))
+	if got := pop(); got.URL.Path != "/c" {
+		t.Errorf("pop after requeue = %s, want /c", got.URL.Path)
+	}
+
+	// Повтор, срок которого подошел, идет раньше задач, поставленных позже этого срока
+	time.Sleep(60 * time.Millisecond)
+	f.push(mk("/e"))
+	order := []string{pop().URL.Path, pop().URL.Path, pop().URL.Path}
+	if order[0] != "/d" || order[1] != "/a" || order[2] != "/e" {
+		t.Errorf("order = %v, want [/d /a /e]", order)
+	}
+
+	if pending, inFlight := f.counts(); pending != 0 || inFlight != 5 {
+		t.Errorf("counts = %d, %d", pending, inFlight)
+	}
+}
+
+func TestFrontierWaitsForRetry(t *testing.T) {
+	f := newFrontier()
+	u, _ := url.Parse("https://example.com/")
+	f.push(task{URL: u})
+	ctx := context.Background()
+	got, _ := f.pop(ctx)
+	f.retry(got, 30*time.Millisecond)
+
+	start := time.Now()
+	got, ok := f.pop(ctx)
+	if !ok || got.Attempt != 1 {
+		t.Fatalf("pop = %+v, %v", got, ok)
+	}
+	if waited := time.Since(start); waited < 25*time.Millisecond {
+		t.Errorf("retry popped after %v, before its NotBefore", waited)
+	}
+	f.done(got)
+	if _, ok := f.pop(ctx); ok {
+		t.Error("pop on finished frontier returned a task")
+	}
+}
@@ -2,9 +2,14 @@ package mirror
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"os"
+	"sync/atomic"
 	"time"
 )
 
@@ -14,30 +19,158 @@ type HttpClient struct {
 	timeout   time.Duration
 }
 
+// NewHttpClient создает клиент, у которого timeout ограничивает каждый этап обмена:
+// соединение, TLS, ожидание заголовков и простой при чтении тела. Общего срока на
+// запрос нет — большой файл качается, пока данные идут.
 func NewHttpClient(timeout time.Duration, userAgent string) *HttpClient {
 	tr := &http.Transport{
-		Proxy:               http.ProxyFromEnvironment,
-		DisableCompression:  false,
-		MaxIdleConnsPerHost: 8,
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		DisableCompression:    false,
+		MaxIdleConnsPerHost:   8,
 	}
 	return &HttpClient{
-		client: &http.Client{
-			Transport: tr,
-			Timeout:   timeout,
-		},
+		client:    &http.Client{Transport: tr},
 		userAgent: userAgent,
 		timeout:   timeout,
 	}
 }
 
+// do выполняет запрос; тело ответа обрывается, если из него ничего не удается
+// прочитать дольше hc.timeout.
+func (hc *HttpClient) do(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	resp, err := hc.client.Do(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = newIdleTimeoutBody(resp.Body, hc.timeout, cancel)
+	return resp, nil
+}
+
+// bodyTimeoutError — тело перестало приходить; это таймаут, и запрос стоит повторить.
+type bodyTimeoutError struct{ d time.Duration }
+
+func (e bodyTimeoutError) Error() string {
+	return fmt.Sprintf("тело ответа не приходило дольше %v", e.d)
+}
+func (bodyTimeoutError) Timeout() bool   { return true }
+func (bodyTimeoutError) Temporary() bool { return true }
+
+// idleTimeoutBody отменяет запрос, если отдельный Read ждет данных дольше timeout.
+// Время между вызовами Read (запись на диск и т. п.) не считается.
+type idleTimeoutBody struct {
+	rc      io.ReadCloser
+	timeout time.Duration
+	cancel  context.CancelFunc
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+func newIdleTimeoutBody(rc io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutBody {
+	b := &idleTimeoutBody{rc: rc, timeout: timeout, cancel: cancel}
+	if timeout > 0 {
+		b.timer = time.AfterFunc(timeout, func() {
+			b.expired.Store(true)
+			cancel()
+		})
+		b.timer.Stop()
+	}
+	return b
+}
+
+func (b *idleTimeoutBody) Read(p []byte) (int, error) {
+	if b.timer == nil {
+		return b.rc.Read(p)
+	}
+	b.timer.Reset(b.timeout)
+	n, err := b.rc.Read(p)
+	b.timer.Stop()
+	if err != nil && err != io.EOF && b.expired.Load() {
+		err = bodyTimeoutError{b.timeout}
+	}
+	return n, err
+}
+
+func (b *idleTimeoutBody) Close() error {
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	err := b.rc.Close()
+	b.cancel()
+	return err
+}
+
 type FetchResult struct {
-	StatusCode  int
-	FinalURL    string
-	ContentType string
-	Body        []byte
+	StatusCode   int
+	FinalURL     string
+	ContentType  string
+	ETag         string
+	LastModified string
+	Header       http.Header
+	// Redirects — URL, ответившие редиректом, по порядку; первый — запрошенный
+	Redirects []string
+
+	// Тело либо в памяти (Body), либо во временном файле (TempFile) — см. GetOptions.InMemory.
+	// Временный файл принадлежит вызывающему: его нужно переместить или удалить.
+	Body     []byte
+	TempFile string
+	Size     int64
+	// SHA256 — hex-дайджест тела
+	SHA256 string
 }
 
-func (hc *HttpClient) Get(ctx context.Context, url string) (*FetchResult, error) {
+// archiveTo включает запись всех обменов в WARC. Сжатие отключается, чтобы
+// в архив попали байты и заголовки в том виде, в каком их отдал сервер.
+func (hc *HttpClient) archiveTo(w *warcWriter, spoolDir string) {
+	next := hc.client.Transport
+	if tr, ok := next.(*http.Transport); ok {
+		tr.DisableCompression = true
+	}
+	hc.client.Transport = &warcTransport{next: next, w: w, spoolDir: spoolDir}
+}
+
+// Validators — валидаторы из прошлого ответа для условного запроса.
+type Validators struct {
+	ETag         string
+	LastModified string
+}
+
+// GetOptions — параметры Get.
+type GetOptions struct {
+	// Если заданы, запрос условный и сервер может ответить 304 с пустым телом
+	Validators Validators
+	// MaxSize — предельный размер тела; 0 — без ограничения. Превышение — errTooLarge
+	MaxSize int64
+	// TempDir — каталог для временных файлов; должен быть на той же ФС, что и зеркало,
+	// чтобы файл можно было атомарно переименовать
+	TempDir string
+	// InMemory решает по Content-Type, читать ли тело в память (HTML/CSS для переписывания);
+	// остальное пишется во временный файл
+	InMemory func(contentType string) bool
+	// Accept решает по Content-Type, нужно ли тело вообще; отказ — errFiltered
+	Accept func(contentType string) bool
+	// Discard — тело, которое не читается в память, дочитывается и выбрасывается
+	// вместо записи во временный файл
+	Discard bool
+}
+
+// Тело, которое держим в памяти для переписывания, не может быть больше этого
+const maxInMemoryBody = 50 << 20
+
+var (
+	// errTooLarge — тело больше MaxSize; URL считается пропущенным, а не упавшим
+	errTooLarge = fmt.Errorf("%w: too large", errSkipped)
+	// errFiltered — тип содержимого не прошел фильтр
+	errFiltered = fmt.Errorf("%w: тип содержимого не проходит фильтр", errSkipped)
+)
+
+// Get скачивает URL. Тело успешного ответа читается в память или потоком пишется
+// во временный файл; размер сверяется с Content-Length, чтобы не сохранить обрезанный файл.
+func (hc *HttpClient) Get(ctx context.Context, url string, opts GetOptions) (*FetchResult, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
 		return nil, err
@@ -45,28 +178,121 @@ func (hc *HttpClient) Get(ctx context.Context, url string) (*FetchResult, error)
 	if hc.userAgent != "" {
 		req.Header.Set("User-Agent", hc.userAgent)
 	}
-	resp, err := hc.client.Do(req)
+	if v := opts.Validators; v.ETag != "" {
+		req.Header.Set("If-None-Match", v.ETag)
+	}
+	if v := opts.Validators; v.LastModified != "" {
+		req.Header.Set("If-Modified-Since", v.LastModified)
+	}
+	resp, err := hc.do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	// Limit body to avoid memory explosion on huge files (e.g. 50MB)
-	const maxBody = 50 << 20
-	body, err := io.ReadAll(io.LimitReader(resp.Body, maxBody))
-	if err != nil {
-		return nil, err
+	ct := resp.Header.Get("Content-Type")
+	res := &FetchResult{
+		StatusCode:   resp.StatusCode,
+		FinalURL:     resp.Request.URL.String(),
+		ContentType:  ct,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Header:       resp.Header,
+	}
+	res.Redirects = redirectChain(resp)
+	// Тело нужно только у успешных ответов. Короткое тело ошибки дочитываем:
+	// соединение вернется в пул, а ответ целиком попадет в WARC
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		return res, nil
+	}
+	if opts.Accept != nil && !opts.Accept(ct) {
+		return nil, errFiltered
+	}
+	if opts.MaxSize > 0 && resp.ContentLength > opts.MaxSize {
+		return nil, errTooLarge
 	}
 
-	ct := resp.Header.Get("Content-Type")
-	return &FetchResult{
-		StatusCode:  resp.StatusCode,
-		FinalURL:    resp.Request.URL.String(),
-		ContentType: ct,
-		Body:        body,
-	}, nil
+	if opts.InMemory == nil || opts.InMemory(ct) {
+		limit := int64(maxInMemoryBody)
+		if opts.MaxSize > 0 {
+			limit = min(limit, opts.MaxSize)
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(body)) > limit {
+			return nil, errTooLarge
+		}
+		res.Body = body
+		res.Size = int64(len(body))
+		sum := sha256.Sum256(body)
+		res.SHA256 = hex.EncodeToString(sum[:])
+	} else if opts.Discard {
+		h := sha256.New()
+		res.Size, err = io.Copy(h, resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		res.SHA256 = hex.EncodeToString(h.Sum(nil))
+	} else {
+		res.TempFile, res.Size, res.SHA256, err = streamToTemp(resp.Body, opts.TempDir, opts.MaxSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// При прозрачной распаковке gzip ContentLength = -1, сверять не с чем
+	if resp.ContentLength >= 0 && res.Size != resp.ContentLength {
+		if res.TempFile != "" {
+			os.Remove(res.TempFile)
+		}
+		return nil, fmt.Errorf("%w: %d байт из %d (Content-Length)", errIncompleteBody, res.Size, resp.ContentLength)
+	}
+	return res, nil
+}
+
+// redirectChain — URL, ответившие редиректом по пути к resp, по порядку.
+func redirectChain(resp *http.Response) []string {
+	var chain []string
+	// У запроса после редиректа Response — ответ, который к нему привел
+	for r := resp.Request; r.Response != nil; r = r.Response.Request {
+		chain = append([]string{r.Response.Request.URL.String()}, chain...)
+	}
+	return chain
+}
+
+func streamToTemp(r io.Reader, dir string, maxSize int64) (string, int64, string, error) {
+	f, err := os.CreateTemp(dir, "download-*")
+	if err != nil {
+		return "", 0, "", err
+	}
+	src := r
+	if maxSize > 0 {
+		src = io.LimitReader(r, maxSize+1)
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), src)
+	if err == nil {
+		// CreateTemp создает файл с правами 0600, а в зеркале файлы 0644
+		err = f.Chmod(0o644)
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil && maxSize > 0 && n > maxSize {
+		err = errTooLarge
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", 0, "", err
+	}
+	return f.Name(), n, hex.EncodeToString(h.Sum(nil)), nil
 }
 
+// GetText скачивает небольшой текстовый ресурс (не больше max байт). Ответы с кодом
+// ошибки возвращаются как есть — решение по статусу принимает вызывающий.
 func (hc *HttpClient) GetText(ctx context.Context, url string, max int64) (*FetchResult, error) {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
 	if err != nil {
@@ -75,7 +301,7 @@ func (hc *HttpClient) GetText(ctx context.Context, url string, max int64) (*Fetc
 	if hc.userAgent != "" {
 		req.Header.Set("User-Agent", hc.userAgent)
 	}
-	resp, err := hc.client.Do(req)
+	resp, err := hc.do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -88,9 +314,6 @@ func (hc *HttpClient) GetText(ctx context.Context, url string, max int64) (*Fetc
 	if err != nil {
 		return nil, err
 	}
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("status %d", resp.StatusCode)
-	}
 	ct := resp.Header.Get("Content-Type")
 	return &FetchResult{
 		StatusCode:  resp.StatusCode,
@@ -99,3 +322,38 @@ func (hc *HttpClient) GetText(ctx context.Context, url string, max int64) (*Fetc
 		Body:        body,
 	}, nil
 }
+
+// Check проверяет, что URL доступен: сначала HEAD, а если он не удался или вернул
+// ошибку (некоторые серверы HEAD не поддерживают) — GET. Тело не читается.
+func (hc *HttpClient) Check(ctx context.Context, url string) (*FetchResult, error) {
+	res, err := hc.probe(ctx, http.MethodHead, url)
+	if err == nil && res.StatusCode < 400 {
+		return res, nil
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return hc.probe(ctx, http.MethodGet, url)
+}
+
+func (hc *HttpClient) probe(ctx context.Context, method, url string) (*FetchResult, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if hc.userAgent != "" {
+		req.Header.Set("User-Agent", hc.userAgent)
+	}
+	resp, err := hc.do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return &FetchResult{
+		StatusCode:  resp.StatusCode,
+		FinalURL:    resp.Request.URL.String(),
+		ContentType: resp.Header.Get("Content-Type"),
+		Header:      resp.Header,
+		Redirects:   redirectChain(resp),
+	}, nil
+}
@@ -0,0 +1,213 @@
+package mirror
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGetStreaming(t *testing.T) {
+	payload := strings.Repeat("0123456789", 1000)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "<p>hi</p>")
+		case "/file.bin":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			fmt.Fprint(w, payload)
+		case "/chunked.bin":
+			// Без Content-Length: предел проверяется по мере чтения
+			w.Header().Set("Content-Type", "application/octet-stream")
+			for i := 0; i < 10; i++ {
+				fmt.Fprint(w, payload[:1000])
+				w.(http.Flusher).Flush()
+			}
+		case "/truncated.bin":
+			// Обещаем больше, чем отдаем, и рвем соединение
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Header().Set("Content-Length", "20000")
+			fmt.Fprint(w, payload[:100])
+			w.(http.Flusher).Flush()
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	hc := NewHttpClient(5*time.Second, "site-mirror-test")
+	tmp := t.TempDir()
+	inMemory := func(ct string) bool { return strings.Contains(ct, "text/html") }
+	get := func(path string, maxSize int64) (*FetchResult, error) {
+		return hc.Get(context.Background(), srv.URL+path, GetOptions{MaxSize: maxSize, TempDir: tmp, InMemory: inMemory})
+	}
+	leftovers := func(t *testing.T) {
+		t.Helper()
+		if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+			t.Errorf("temp files left behind: %d", len(entries))
+		}
+	}
+
+	t.Run("html in memory", func(t *testing.T) {
+		res, err := get("/page", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res.Body) != "<p>hi</p>" || res.TempFile != "" || res.Size != 9 {
+			t.Errorf("body %q, temp %q, size %d", res.Body, res.TempFile, res.Size)
+		}
+	})
+
+	t.Run("binary to temp file", func(t *testing.T) {
+		res, err := get("/file.bin", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.Remove(res.TempFile)
+		if res.Body != nil || !strings.HasPrefix(res.TempFile, tmp) {
+			t.Fatalf("body in memory or temp file %q outside %s", res.TempFile, tmp)
+		}
+		data, err := os.ReadFile(res.TempFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256([]byte(payload))
+		if string(data) != payload || res.Size != int64(len(payload)) || res.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("size %d, sha256 %s", res.Size, res.SHA256)
+		}
+		if fi, _ := os.Stat(res.TempFile); fi.Mode().Perm() != 0o644 {
+			t.Errorf("temp file mode %v, want 0644", fi.Mode().Perm())
+		}
+	})
+
+	for _, path := range []string{"/file.bin", "/chunked.bin", "/page"} {
+		t.Run("too large "+path, func(t *testing.T) {
+			_, err := get(path, 5)
+			if !errors.Is(err, errTooLarge) || !errors.Is(err, errSkipped) {
+				t.Errorf("err = %v, want errTooLarge", err)
+			}
+			leftovers(t)
+		})
+	}
+
+	t.Run("truncated body", func(t *testing.T) {
+		_, err := get("/truncated.bin", 0)
+		if err == nil {
+			t.Fatal("truncated body accepted")
+		}
+		// Обрыв — временная ошибка, ее стоит повторить
+		if !isNetworkError(err) {
+			t.Errorf("err = %v is not retryable", err)
+		}
+		leftovers(t)
+	})
+}
+
+func TestGetSlowBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		switch r.URL.Path {
+		case "/slow.bin":
+			// Тело идет дольше таймаута, но паузы между байтами короче него
+			w.Header().Set("Content-Length", "10")
+			for i := 0; i < 10; i++ {
+				fmt.Fprint(w, i)
+				w.(http.Flusher).Flush()
+				time.Sleep(100 * time.Millisecond)
+			}
+		case "/stalled.bin":
+			w.Header().Set("Content-Length", "10")
+			fmt.Fprint(w, "0")
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+	}))
+	defer srv.Close()
+
+	hc := NewHttpClient(300*time.Millisecond, "site-mirror-test")
+	tmp := t.TempDir()
+	res, err := hc.Get(context.Background(), srv.URL+"/slow.bin", GetOptions{TempDir: tmp, InMemory: func(string) bool { return false }})
+	if err != nil {
+		t.Fatalf("slow body: %v", err)
+	}
+	defer os.Remove(res.TempFile)
+	if data, _ := os.ReadFile(res.TempFile); string(data) != "0123456789" {
+		t.Errorf("slow body = %q", data)
+	}
+
+	// Тело, которое перестало приходить, обрывается по таймауту простоя, и это повторяемая ошибка
+	start := time.Now()
+	_, err = hc.Get(context.Background(), srv.URL+"/stalled.bin", GetOptions{})
+	if err == nil {
+		t.Fatal("stalled body accepted")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Errorf("stalled body aborted after %v", time.Since(start))
+	}
+	if !isNetworkError(err) {
+		t.Errorf("err = %v is not retryable", err)
+	}
+}
+
+func TestCrawlSkipsTooLarge(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<img src="/small.png"><img src="/big.png">`)
+		case "/small.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "PNG")
+		case "/big.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, strings.Repeat("x", 1000))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL + "/")
+	out := t.TempDir()
+	c, err := NewCrawler(Config{BaseURL: base, OutputDir: out, MaxDepth: 1, Concurrency: 1, MaxFileSize: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	host := strings.ReplaceAll(base.Host, ":", "_")
+	if _, err := os.Stat(filepath.Join(out, host, "small.png")); err != nil {
+		t.Errorf("small file not saved: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(out, host, "big.png")); err == nil {
+		t.Error("file over -max-file-size saved")
+	}
+	big, _ := url.Parse(srv.URL + "/big.png")
+	o := c.outcomes[c.key(big)]
+	if o.Status != outcomeSkipped || !strings.Contains(o.Error, "too large") {
+		t.Errorf("big.png outcome %+v, want skipped: too large", o)
+	}
+	// Временный каталог загрузок не остается в зеркале
+	if _, err := os.Stat(filepath.Join(out, ".site-mirror-tmp")); err == nil {
+		t.Error(".site-mirror-tmp left in output")
+	}
+}
@@ -0,0 +1,172 @@
+package mirror
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Сколько самых медленных и самых больших ресурсов попадает в отчет
+const reportTopN = 10
+
+// manifestEntry — строка манифеста: итог обработки одного URL.
+type manifestEntry struct {
+	URL         string `json:"url"`
+	Canonical   string `json:"canonical,omitempty"` // ключ для сравнения URL, если отличается от url
+	FinalURL    string `json:"final_url,omitempty"`
+	Status      string `json:"status"`
+	HTTPStatus  int    `json:"http_status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256,omitempty"`
+	LocalPath   string `json:"local_path,omitempty"`
+	DuplicateOf string `json:"duplicate_of,omitempty"`
+	Depth       int    `json:"depth"`
+	Referrer    string `json:"referrer,omitempty"`
+	Error       string `json:"error,omitempty"`
+	FetchMs     int64  `json:"fetch_ms,omitempty"`
+	Attempts    int    `json:"attempts,omitempty"`
+}
+
+// crawlReport — сводка по обходу.
+type crawlReport struct {
+	BaseURL    string           `json:"base_url"`
+	Total      int              `json:"total"`
+	Bytes      int64            `json:"bytes"`
+	Duplicates int              `json:"duplicates"`        // файлов с уже сохраненным содержимым
+	DedupSaved int64            `json:"dedup_saved_bytes"` // сколько байт на них сэкономлено
+	ByStatus   map[string]int   `json:"by_status"`
+	ByHTTPCode map[string]int   `json:"by_http_status,omitempty"`
+	Slowest    []reportResource `json:"slowest"`
+	Largest    []reportResource `json:"largest"`
+}
+
+type reportResource struct {
+	URL         string `json:"url"`
+	FetchMs     int64  `json:"fetch_ms"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// manifestEntries — итоги всех обработанных URL, упорядоченные по URL.
+func (c *Crawler) manifestEntries() []manifestEntry {
+	c.mu.Lock()
+	entries := make([]manifestEntry, 0, len(c.outcomes))
+	for k, o := range c.outcomes {
+		u := o.requestedURL(k)
+		if u == k {
+			k = ""
+		}
+		entries = append(entries, manifestEntry{
+			URL:         u,
+			Canonical:   k,
+			FinalURL:    o.FinalURL,
+			Status:      o.Status,
+			HTTPStatus:  o.HTTPStatus,
+			ContentType: o.ContentType,
+			Size:        o.Size,
+			SHA256:      o.SHA256,
+			LocalPath:   o.LocalPath,
+			DuplicateOf: o.DuplicateOf,
+			Depth:       o.Depth,
+			Referrer:    o.From,
+			Error:       o.Error,
+			FetchMs:     o.FetchMs,
+			Attempts:    o.Attempts,
+		})
+	}
+	c.mu.Unlock()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].URL < entries[j].URL })
+	return entries
+}
+
+// writeManifest записывает манифест (JSON lines) в Config.Manifest и сводку в Config.Report;
+// краткая сводка всегда уходит в лог.
+func (c *Crawler) writeManifest() error {
+	entries := c.manifestEntries()
+	if c.cfg.Manifest != "" {
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		for _, e := range entries {
+			if err := enc.Encode(e); err != nil {
+				return err
+			}
+		}
+		if err := writeFileAtomic(c.cfg.Manifest, buf.Bytes(), 0o644); err != nil {
+			return fmt.Errorf("манифест: %w", err)
+		}
+	}
+
+	r := buildReport(c.base.String(), entries)
+	log.Printf("Итого %d URL, %d байт: %s", r.Total, r.Bytes, formatCounts(r.ByStatus))
+	if r.Duplicates > 0 {
+		log.Printf("Дубликатов %d, сэкономлено %d байт", r.Duplicates, r.DedupSaved)
+	}
+	if c.cfg.Report != "" {
+		data, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(c.cfg.Report, append(data, '\n'), 0o644); err != nil {
+			return fmt.Errorf("отчет: %w", err)
+		}
+	}
+	return nil
+}
+
+func buildReport(base string, entries []manifestEntry) crawlReport {
+	r := crawlReport{
+		BaseURL:    base,
+		Total:      len(entries),
+		ByStatus:   make(map[string]int),
+		ByHTTPCode: make(map[string]int),
+	}
+	var fetched []manifestEntry
+	for _, e := range entries {
+		r.ByStatus[e.Status]++
+		if e.HTTPStatus != 0 {
+			r.ByHTTPCode[strconv.Itoa(e.HTTPStatus)]++
+		}
+		r.Bytes += e.Size
+		if e.DuplicateOf != "" {
+			r.Duplicates++
+			r.DedupSaved += e.Size
+		}
+		// Размер и время есть только у реально скачанного, 304 и копии из кэша не в счет
+		if e.FetchMs > 0 && e.Status != outcomeNotModified {
+			fetched = append(fetched, e)
+		}
+	}
+	r.Slowest = topResources(fetched, func(a, b manifestEntry) bool { return a.FetchMs > b.FetchMs })
+	r.Largest = topResources(fetched, func(a, b manifestEntry) bool { return a.Size > b.Size })
+	return r
+}
+
+func topResources(entries []manifestEntry, less func(a, b manifestEntry) bool) []reportResource {
+	sorted := append([]manifestEntry(nil), entries...)
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	out := []reportResource{}
+	for _, e := range sorted[:min(reportTopN, len(sorted))] {
+		out = append(out, reportResource{URL: e.URL, FetchMs: e.FetchMs, Size: e.Size, ContentType: e.ContentType})
+	}
+	return out
+}
+
+// formatCounts — "failed 2, saved 10" в алфавитном порядке статусов.
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s %d", k, counts[k])
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,35 @@
+package mirror
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestBuildReport(t *testing.T) {
+	entries := []manifestEntry{
+		{URL: "https://example.com/", Status: outcomeSaved, HTTPStatus: 200, Size: 100, FetchMs: 50},
+		{URL: "https://example.com/big.zip", Status: outcomeSaved, HTTPStatus: 200, Size: 5000, FetchMs: 20},
+		{URL: "https://example.com/slow", Status: outcomeSaved, HTTPStatus: 200, Size: 10, FetchMs: 900},
+		{URL: "https://example.com/same", Status: outcomeNotModified, HTTPStatus: 304, Size: 7000, FetchMs: 1000},
+		{URL: "https://example.com/missing", Status: outcomeFailed, HTTPStatus: 404, Error: "HTTP 404", FetchMs: 5},
+		{URL: "https://example.com/private", Status: outcomeSkipped, Error: "skipped: robots.txt"},
+	}
+	r := buildReport("https://example.com/", entries)
+
+	if r.Total != 6 || r.Bytes != 12110 {
+		t.Errorf("total = %d, bytes = %d", r.Total, r.Bytes)
+	}
+	if got := fmt.Sprint(r.ByStatus); got != "map[failed:1 not-modified:1 saved:3 skipped:1]" {
+		t.Errorf("by status = %s", got)
+	}
+	if got := fmt.Sprint(r.ByHTTPCode); got != "map[200:3 304:1 404:1]" {
+		t.Errorf("by http status = %s", got)
+	}
+	// 304 не скачивался заново — ни в самые медленные, ни в самые большие не попадает
+	if len(r.Slowest) != 4 || r.Slowest[0].URL != "https://example.com/slow" {
+		t.Errorf("slowest = %v", r.Slowest)
+	}
+	if r.Largest[0].URL != "https://example.com/big.zip" {
+		t.Errorf("largest = %v", r.Largest)
+	}
+}
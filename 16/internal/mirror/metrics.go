@@ -0,0 +1,153 @@
+package mirror
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Границы корзин гистограмм
+var (
+	fetchSecondsBuckets  = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+	responseBytesBuckets = []float64{1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20, 100 << 20}
+)
+
+// crawlMetrics — счетчики текущего запуска, которые обновляют воркеры. Отдаются
+// на /metrics в текстовом формате Prometheus и показываются в строке прогресса.
+type crawlMetrics struct {
+	mu            sync.Mutex
+	httpStatus    map[int]int64    // ответы по HTTP-кодам
+	outcomes      map[string]int64 // итоги по статусам (saved, failed, ...)
+	fetchSeconds  *histogram
+	responseBytes *histogram
+}
+
+func newCrawlMetrics() *crawlMetrics {
+	return &crawlMetrics{
+		httpStatus:    make(map[int]int64),
+		outcomes:      make(map[string]int64),
+		fetchSeconds:  newHistogram(fetchSecondsBuckets),
+		responseBytes: newHistogram(responseBytesBuckets),
+	}
+}
+
+// fetched учитывает полученный ответ; размер — только у успешных, у остальных тела нет.
+func (m *crawlMetrics) fetched(status int, elapsed time.Duration, size int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.httpStatus[status]++
+	m.fetchSeconds.observe(elapsed.Seconds())
+	if status >= 200 && status < 300 {
+		m.responseBytes.observe(float64(size))
+	}
+}
+
+func (m *crawlMetrics) finished(status string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.outcomes[status]++
+}
+
+// done — сколько URL обработано всего и сколько из них с ошибкой.
+func (m *crawlMetrics) done() (total, failed int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, n := range m.outcomes {
+		total += n
+	}
+	return total, m.outcomes[outcomeFailed]
+}
+
+type histogram struct {
+	bounds []float64
+	counts []uint64 // counts[i] — наблюдений <= bounds[i], без накопления; последний — +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	i := sort.SearchFloat64s(h.bounds, v)
+	h.counts[i]++
+	h.sum += v
+	h.count++
+}
+
+// write выводит гистограмму в формате Prometheus: корзины le накопительные.
+func (h *histogram) write(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var cum uint64
+	for i, b := range h.bounds {
+		cum += h.counts[i]
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", name, strconv.FormatFloat(b, 'g', -1, 64), cum)
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", name, strconv.FormatFloat(h.sum, 'g', -1, 64), name, h.count)
+}
+
+// serveMetrics отдает метрики обхода.
+func (c *Crawler) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.writeMetrics(w)
+}
+
+func (c *Crawler) writeMetrics(w io.Writer) {
+	pending, inFlight := c.frontier.counts()
+	gauge := func(name, help string, v int64) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, v)
+	}
+	gauge("sitemirror_queue_length", "URL в очереди", int64(pending))
+	gauge("sitemirror_in_flight", "URL, которые скачиваются сейчас", int64(inFlight))
+	fmt.Fprintf(w, "# HELP sitemirror_downloaded_bytes_total Скачано байт тел ответов\n# TYPE sitemirror_downloaded_bytes_total counter\nsitemirror_downloaded_bytes_total %d\n", c.bytes.Load())
+
+	m := c.metrics
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP sitemirror_responses_total HTTP-ответы по кодам\n# TYPE sitemirror_responses_total counter\n")
+	codes := make([]int, 0, len(m.httpStatus))
+	for code := range m.httpStatus {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(w, "sitemirror_responses_total{code=\"%d\"} %d\n", code, m.httpStatus[code])
+	}
+
+	fmt.Fprintf(w, "# HELP sitemirror_urls_total Обработанные URL по итогам\n# TYPE sitemirror_urls_total counter\n")
+	statuses := make([]string, 0, len(m.outcomes))
+	for s := range m.outcomes {
+		statuses = append(statuses, s)
+	}
+	sort.Strings(statuses)
+	for _, s := range statuses {
+		fmt.Fprintf(w, "sitemirror_urls_total{outcome=%q} %d\n", s, m.outcomes[s])
+	}
+
+	m.fetchSeconds.write(w, "sitemirror_fetch_duration_seconds", "Время загрузки URL вместе с телом")
+	m.responseBytes.write(w, "sitemirror_response_size_bytes", "Размер тел успешных ответов")
+}
+
+// startMetricsServer поднимает HTTP-сервер с /metrics на Config.MetricsAddr;
+// возвращенная функция его останавливает.
+func (c *Crawler) startMetricsServer() (stop func(), err error) {
+	ln, err := net.Listen("tcp", c.cfg.MetricsAddr)
+	if err != nil {
+		return nil, fmt.Errorf("метрики: %w", err)
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", c.serveMetrics)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go srv.Serve(ln)
+	log.Printf("Метрики: http://%s/metrics", ln.Addr())
+	return func() { srv.Close() }, nil
+}
@@ -0,0 +1,26 @@
+package mirror
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHistogramWrite(t *testing.T) {
+	h := newHistogram([]float64{1, 5})
+	for _, v := range []float64{0.5, 1, 3, 7} {
+		h.observe(v)
+	}
+	var b strings.Builder
+	h.write(&b, "x_seconds", "test")
+	want := `# HELP x_seconds test
+# TYPE x_seconds histogram
+x_seconds_bucket{le="1"} 2
+x_seconds_bucket{le="5"} 3
+x_seconds_bucket{le="+Inf"} 4
+x_seconds_sum 11.5
+x_seconds_count 4
+`
+	if b.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
@@ -3,6 +3,7 @@ package mirror
 import (
 	"crypto/sha1"
 	"encoding/hex"
+	"mime"
 	"net/url"
 	"path"
 	"path/filepath"
@@ -31,6 +32,11 @@ func urlKey(u *url.URL) string {
 	return n.String()
 }
 
+// isHTTPURL — URL, который можно запросить по HTTP.
+func isHTTPURL(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
 func sameHost(a, b *url.URL) bool {
 	return strings.EqualFold(a.Hostname(), b.Hostname())
 }
@@ -65,46 +71,46 @@ func isHTMLLikeByPath(u *url.URL) bool {
 
 // localPathForURL возвращает относительный к корню зеркала путь для данного URL.
 // Стратегия маппинга: out/<host>/<path> и для "страниц" без расширения — index.html.
+// Это догадка по одному URL; после скачивания путь выбирает localPathFor.
 func localPathForURL(u *url.URL) string {
+	return localPathFor(u, "", "")
+}
+
+// localPathFor — путь для скачанного ответа: расширение выбирается по Content-Type,
+// когда путь URL о типе ничего не говорит (/api/logo -> api/logo.png, /page.php с HTML ->
+// page.php.html), а имя файла из Content-Disposition заменяет последний сегмент пути.
+// С пустыми contentType и disposition совпадает с localPathForURL.
+func localPathFor(u *url.URL, contentType, disposition string) string {
 	hostDir := sanitizeFilename(strings.ToLower(u.Host))
 	p := u.EscapedPath()
 	if p == "" {
 		p = "/"
 	}
-	// Добавим уникальность для query, чтобы не было коллизий
-	var querySuffix string
-	if u.RawQuery != "" {
-		h := sha1.Sum([]byte(u.RawQuery))
-		querySuffix = "_q_" + hex.EncodeToString(h[:4])
+	mt, _, _ := mime.ParseMediaType(contentType)
+	if name := dispositionFilename(disposition); name != "" {
+		p = path.Join(path.Dir(p+"x"), name)
 	}
 
 	ext := strings.ToLower(path.Ext(p))
-	isHTML := isHTMLLikeByPath(u)
-
-	// Нормализуем базовый путь
-	if strings.HasSuffix(p, "/") || p == "/" {
-		if isHTML {
-			p = path.Join(p, "index.html")
-		} else {
-			p = path.Join(p, "index")
-		}
-	} else if ext == "" {
-		if isHTML {
+	isDir := strings.HasSuffix(p, "/")
+	switch {
+	case mt == "" || isHTMLType(mt):
+		// Страницы: каталог или путь без расширения — index.html внутри
+		if isDir || ext == "" {
 			p = path.Join(p, "index.html")
-		} else {
-			// для ассетов без расширения оставляем как есть, но добавим .bin
-			p = p + ".bin"
+		} else if mt != "" && !isHTMLExt(ext) {
+			p += ".html"
 		}
+	case isDir:
+		p = path.Join(p, "index"+extensionForType(mt))
+	case ext == "":
+		p += extensionForType(mt)
 	}
 
-	// Вставим querySuffix перед расширением, если есть
-	if querySuffix != "" {
-		if ext == "" {
-			p = p + querySuffix
-		} else {
-			base := strings.TrimSuffix(p, ext)
-			p = base + querySuffix + ext
-		}
+	// Добавим уникальность для query, чтобы не было коллизий; суффикс — перед расширением
+	if u.RawQuery != "" {
+		h := sha1.Sum([]byte(u.RawQuery))
+		p = withNameSuffix(p, "_q_"+hex.EncodeToString(h[:4]))
 	}
 
 	// Санитизация компонентов
@@ -119,6 +125,88 @@ func localPathForURL(u *url.URL) string {
 	return filepath.FromSlash(filepath.Join(hostDir, p))
 }
 
+// withNameSuffix вставляет suffix в имя файла перед расширением: a/img.png -> a/img_x.png.
+func withNameSuffix(p, suffix string) string {
+	ext := path.Ext(p)
+	return strings.TrimSuffix(p, ext) + suffix + ext
+}
+
+// urlSuffix — суффикс имени, различающий URL с одинаковым путем в зеркале; attempt > 1,
+// если и суффикс с предыдущей попытки оказался занят.
+func urlSuffix(u *url.URL, attempt int) string {
+	h := sha1.Sum([]byte(u.String() + strings.Repeat("#", attempt-1)))
+	return "_u_" + hex.EncodeToString(h[:4])
+}
+
+func isHTMLType(mt string) bool {
+	return mt == "text/html" || mt == "application/xhtml+xml"
+}
+
+func isHTMLExt(ext string) bool {
+	switch ext {
+	case ".html", ".htm", ".xhtml", ".shtml":
+		return true
+	}
+	return false
+}
+
+// Предпочтительные расширения: mime.ExtensionsByType возвращает варианты
+// в произвольном для нас порядке (.jpe раньше .jpg).
+var typeExtensions = map[string]string{
+	"text/css":                 ".css",
+	"text/javascript":          ".js",
+	"application/javascript":   ".js",
+	"application/json":         ".json",
+	"application/xml":          ".xml",
+	"text/xml":                 ".xml",
+	"text/plain":               ".txt",
+	"image/png":                ".png",
+	"image/jpeg":               ".jpg",
+	"image/gif":                ".gif",
+	"image/webp":               ".webp",
+	"image/avif":               ".avif",
+	"image/svg+xml":            ".svg",
+	"image/x-icon":             ".ico",
+	"image/vnd.microsoft.icon": ".ico",
+	"font/woff":                ".woff",
+	"font/woff2":               ".woff2",
+	"font/ttf":                 ".ttf",
+	"font/otf":                 ".otf",
+	"application/pdf":          ".pdf",
+	"application/zip":          ".zip",
+	"video/mp4":                ".mp4",
+	"video/webm":               ".webm",
+	"audio/mpeg":               ".mp3",
+}
+
+func extensionForType(mt string) string {
+	if ext, ok := typeExtensions[mt]; ok {
+		return ext
+	}
+	if exts, _ := mime.ExtensionsByType(mt); len(exts) > 0 {
+		return exts[0]
+	}
+	return ".bin"
+}
+
+// dispositionFilename — имя файла из Content-Disposition (filename* уже раскодирован
+// mime.ParseMediaType); каталоги из имени отбрасываются. Имя не экранируется:
+// ссылка на файл с пробелом в имени браузер откроет.
+func dispositionFilename(disposition string) string {
+	if disposition == "" {
+		return ""
+	}
+	_, params, err := mime.ParseMediaType(disposition)
+	if err != nil {
+		return ""
+	}
+	name := path.Base(strings.ReplaceAll(params["filename"], "\\", "/"))
+	if name == "." || name == "/" || name == ".." {
+		return ""
+	}
+	return sanitizeFilename(name)
+}
+
 func relativeLink(fromLocalPath, toLocalPath string) string {
 	fromDir := filepath.Dir(fromLocalPath)
 	rel, err := filepath.Rel(fromDir, toLocalPath)
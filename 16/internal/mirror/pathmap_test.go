@@ -0,0 +1,92 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalPathFor(t *testing.T) {
+	tests := []struct {
+		url         string
+		contentType string
+		disposition string
+		want        string
+	}{
+		{url: "https://example.com/", want: "example.com/index.html"},
+		{url: "https://example.com/docs", want: "example.com/docs/index.html"},
+		{url: "https://example.com/docs", contentType: "text/html; charset=utf-8", want: "example.com/docs/index.html"},
+		{url: "https://example.com/style.css", contentType: "text/css", want: "example.com/style.css"},
+		{url: "https://example.com/api/logo", contentType: "image/png", want: "example.com/api/logo.png"},
+		{url: "https://example.com/api/", contentType: "application/json", want: "example.com/api/index.json"},
+		{url: "https://example.com/page.php", contentType: "text/html", want: "example.com/page.php.html"},
+		{url: "https://example.com/a.htm", contentType: "text/html", want: "example.com/a.htm"},
+		{url: "https://example.com/blob", contentType: "application/x-unknown-type", want: "example.com/blob.bin"},
+		{url: "https://example.com/dl?id=5", contentType: "application/pdf", disposition: `attachment; filename="../report.pdf"`,
+			want: "example.com/report_q_0d94b291.pdf"},
+		{url: "https://example.com/list?page=2", want: "example.com/list/index_q_b941a131.html"},
+	}
+	for _, tt := range tests {
+		u, err := url.Parse(tt.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := filepath.ToSlash(localPathFor(u, tt.contentType, tt.disposition)); got != tt.want {
+			t.Errorf("localPathFor(%s, %q, %q) = %s, want %s", tt.url, tt.contentType, tt.disposition, got, tt.want)
+		}
+	}
+}
+
+func TestCrawlDispositionCollision(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/dl/1">one</a> <a href="/dl/2">two</a>`)
+		case "/dl/1", "/dl/2":
+			// Оба ответа называют файл одинаково
+			w.Header().Set("Content-Type", "application/pdf")
+			w.Header().Set("Content-Disposition", `attachment; filename="report.pdf"`)
+			fmt.Fprint(w, "PDF "+r.URL.Path)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL + "/")
+	store := NewMemoryStorage()
+	c, err := NewCrawler(Config{BaseURL: base, Storage: store, MaxDepth: 1, Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	host := strings.ReplaceAll(base.Host, ":", "_")
+	index, _ := store.ReadFile(host + "/index.html")
+	for _, p := range []string{"/dl/1", "/dl/2"} {
+		u, _ := url.Parse(srv.URL + p)
+		o := c.outcomes[c.key(u)]
+		name := filepath.ToSlash(o.LocalPath)
+		if !strings.HasPrefix(name, host+"/dl/report") || !strings.HasSuffix(name, ".pdf") {
+			t.Errorf("%s saved as %s", p, name)
+		}
+		// Каждый файл на своем месте, и ссылка ведет к нему
+		if data, _ := store.ReadFile(name); string(data) != "PDF "+p {
+			t.Errorf("%s: %s holds %q", p, name, data)
+		}
+		if link := strings.TrimPrefix(name, host+"/"); !strings.Contains(string(index), `href="`+link+`"`) {
+			t.Errorf("index.html lacks link to %s:\n%s", link, index)
+		}
+	}
+	if n := len(store.Names()); n != 3 {
+		t.Errorf("stored %v, want index and two reports", store.Names())
+	}
+}
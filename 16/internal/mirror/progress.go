@@ -0,0 +1,110 @@
+package mirror
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+// Как часто обновлять строку прогресса
+const progressInterval = time.Second
+
+// progressLine — строка прогресса внизу терминала. Через нее идет и вывод log:
+// перед сообщением строка стирается, после — рисуется снова, чтобы они не смешивались.
+type progressLine struct {
+	mu   sync.Mutex
+	out  io.Writer
+	line string
+}
+
+func (p *progressLine) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.line != "" {
+		io.WriteString(p.out, "\r\033[K")
+	}
+	n, err := p.out.Write(b)
+	if p.line != "" {
+		io.WriteString(p.out, p.line)
+	}
+	return n, err
+}
+
+func (p *progressLine) set(line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.line = line
+	io.WriteString(p.out, "\r\033[K"+line)
+}
+
+// close оставляет последнюю строку на экране и переводит курсор на новую.
+func (p *progressLine) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.line != "" {
+		io.WriteString(p.out, "\n")
+		p.line = ""
+	}
+}
+
+// startProgress показывает строку прогресса, пока не вызвана возвращенная функция.
+func (c *Crawler) startProgress() (stop func()) {
+	p := &progressLine{out: log.Writer()}
+	log.SetOutput(p)
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		last, lastBytes, lastDone := time.Now(), c.bytes.Load(), int64(0)
+		for {
+			select {
+			case <-stopCh:
+				p.set(c.progressText(0, 0))
+				return
+			case now := <-ticker.C:
+				bytes := c.bytes.Load()
+				total, _ := c.metrics.done()
+				sec := now.Sub(last).Seconds()
+				p.set(c.progressText(float64(total-lastDone)/sec, float64(bytes-lastBytes)/sec))
+				last, lastBytes, lastDone = now, bytes, total
+			}
+		}
+	}()
+	return func() {
+		close(stopCh)
+		<-done
+		p.close()
+		log.SetOutput(p.out)
+	}
+}
+
+// progressText — "очередь 120, в работе 8, готово 340 (ошибок 3), 12.3 MB, 4.0 URL/с, 450.0 KB/с";
+// скорость не выводится, если она нулевая (итоговая строка).
+func (c *Crawler) progressText(urlRate, byteRate float64) string {
+	pending, inFlight := c.frontier.counts()
+	total, failed := c.metrics.done()
+	s := fmt.Sprintf("очередь %d, в работе %d, готово %d (ошибок %d), %s",
+		pending, inFlight, total, failed, formatBytes(float64(c.bytes.Load())))
+	if urlRate > 0 || byteRate > 0 {
+		s += fmt.Sprintf(", %.1f URL/с, %s/с", urlRate, formatBytes(byteRate))
+	}
+	return s
+}
+
+func formatBytes(n float64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	div, exp := float64(unit), 0
+	for n/div >= unit && exp < 4 {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", n/div, "KMGTP"[exp])
+}
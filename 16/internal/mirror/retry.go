@@ -0,0 +1,149 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy — когда и как повторять неудачные загрузки.
+type RetryPolicy struct {
+	MaxAttempts   int           // всего попыток, включая первую; <= 1 — без повторов
+	BaseDelay     time.Duration // задержка перед второй попыткой, дальше удваивается
+	MaxDelay      time.Duration // потолок задержки, в том числе из Retry-After; 0 — без потолка
+	RetryStatuses []int         // HTTP-коды, при которых стоит повторить
+	NetworkErrors bool          // повторять при сетевых ошибках и обрыве тела
+}
+
+// DefaultRetryPolicy — 4 попытки с задержкой 1s, 2s, 4s (±джиттер) на временные ошибки.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:   4,
+		BaseDelay:     time.Second,
+		MaxDelay:      time.Minute,
+		RetryStatuses: []int{408, 425, 429, 500, 502, 503, 504},
+		NetworkErrors: true,
+	}
+}
+
+// ParseStatusList разбирает список кодов вида "429,503".
+func ParseStatusList(s string) ([]int, error) {
+	var out []int
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		code, err := strconv.Atoi(part)
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("некорректный HTTP-код %q", part)
+		}
+		out = append(out, code)
+	}
+	return out, nil
+}
+
+// httpStatusError — ответ с кодом ошибки; retryAfter — из заголовка Retry-After, если был.
+type httpStatusError struct {
+	code       int
+	retryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("HTTP %d", e.code)
+}
+
+// errIncompleteBody — тело оборвалось раньше, чем обещал Content-Length
+var errIncompleteBody = errors.New("тело ответа получено не полностью")
+
+// retryDelay решает, повторять ли задачу после ошибки, и через сколько.
+// attempt — номер уже сделанной попытки, начиная с 1.
+func (p RetryPolicy) retryDelay(attempt int, err error) (time.Duration, bool) {
+	if err == nil || attempt >= p.MaxAttempts || errors.Is(err, errSkipped) {
+		return 0, false
+	}
+
+	var se *httpStatusError
+	if errors.As(err, &se) {
+		if !slices.Contains(p.RetryStatuses, se.code) {
+			return 0, false
+		}
+		if se.retryAfter > 0 && (se.code == http.StatusTooManyRequests || se.code == http.StatusServiceUnavailable) {
+			return se.retryAfter, true
+		}
+		return p.backoff(attempt), true
+	}
+
+	if p.NetworkErrors && isNetworkError(err) {
+		return p.backoff(attempt), true
+	}
+	return 0, false
+}
+
+// backoff — экспоненциальная задержка с джиттером в диапазоне [d/2, d].
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// isNetworkError — временный сбой сети, после которого запрос может пройти: таймаут,
+// сброс или отказ в соединении, обрыв тела. Остальные ошибки клиента (неизвестная
+// схема, сертификат, слишком много редиректов) от повтора не исправятся.
+func isNetworkError(err error) bool {
+	// *url.Error сам реализует net.Error, поэтому классифицируем то, что он оборачивает
+	var ue *url.Error
+	if errors.As(err, &ue) {
+		err = ue.Err
+	}
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout() ||
+		errors.Is(err, errIncompleteBody) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// retryAfter — задержка из заголовка Retry-After, не больше MaxDelay: сервер, попросивший
+// подождать сутки, не должен останавливать обход на сутки.
+func (p RetryPolicy) retryAfter(h http.Header) time.Duration {
+	d := parseRetryAfter(h.Get("Retry-After"))
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// parseRetryAfter понимает оба формата Retry-After: секунды и HTTP-дату.
+func parseRetryAfter(v string) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
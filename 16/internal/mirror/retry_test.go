@@ -0,0 +1,169 @@
+package mirror
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		in       string
+		min, max time.Duration
+	}{
+		{"", 0, 0},
+		{"120", 2 * time.Minute, 2 * time.Minute},
+		{" 5 ", 5 * time.Second, 5 * time.Second},
+		{"0", 0, 0},
+		{"-3", 0, 0},
+		{"soon", 0, 0},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 59 * time.Minute, time.Hour},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.in); got < tt.min || got > tt.max {
+			t.Errorf("parseRetryAfter(%q) = %v, want [%v, %v]", tt.in, got, tt.min, tt.max)
+		}
+	}
+
+	// Потолок MaxDelay действует и на Retry-After
+	p := RetryPolicy{MaxDelay: time.Minute}
+	if got := p.retryAfter(http.Header{"Retry-After": {"86400"}}); got != time.Minute {
+		t.Errorf("retryAfter(86400) = %v, want capped to 1m", got)
+	}
+	p.MaxDelay = 0
+	if got := p.retryAfter(http.Header{"Retry-After": {"86400"}}); got != 24*time.Hour {
+		t.Errorf("retryAfter without cap = %v, want 24h", got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := RetryPolicy{BaseDelay: time.Second, MaxDelay: 5 * time.Second}
+	// Задержка удваивается до потолка; джиттер — в пределах [d/2, d]
+	for attempt, d := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 40: 5 * time.Second} {
+		for i := 0; i < 20; i++ {
+			if got := p.backoff(attempt); got < d/2 || got > d {
+				t.Fatalf("backoff(%d) = %v, want [%v, %v]", attempt, got, d/2, d)
+			}
+		}
+	}
+	if got := (RetryPolicy{}).backoff(3); got != 0 {
+		t.Errorf("zero policy backoff = %v", got)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Second, MaxDelay: time.Minute, RetryStatuses: []int{429, 503}, NetworkErrors: true}
+	tests := []struct {
+		name    string
+		attempt int
+		err     error
+		retry   bool
+		exact   time.Duration
+	}{
+		{name: "success", attempt: 1, err: nil},
+		{name: "retryable status", attempt: 1, err: &httpStatusError{code: 503}, retry: true},
+		{name: "status not in list", attempt: 1, err: &httpStatusError{code: 404}},
+		{name: "attempts exhausted", attempt: 3, err: &httpStatusError{code: 503}},
+		{name: "retry-after honored", attempt: 1, err: &httpStatusError{code: 429, retryAfter: 7 * time.Second}, retry: true, exact: 7 * time.Second},
+		{name: "network error", attempt: 2, err: fmt.Errorf("read: %w", io.ErrUnexpectedEOF), retry: true},
+		{name: "incomplete body", attempt: 1, err: fmt.Errorf("%w: 1 из 2", errIncompleteBody), retry: true},
+		{name: "timeout", attempt: 1, err: &url.Error{Op: "Get", URL: "https://example.com/", Err: bodyTimeoutError{time.Second}}, retry: true},
+		{name: "connection refused", attempt: 1, err: &url.Error{Op: "Get", URL: "https://example.com/", Err: &net.OpError{Op: "dial", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}}, retry: true},
+		{name: "unsupported scheme", attempt: 1, err: &url.Error{Op: "Get", URL: "tel:+123", Err: errors.New(`unsupported protocol scheme "tel"`)}},
+		{name: "bad certificate", attempt: 1, err: &url.Error{Op: "Get", URL: "https://example.com/", Err: x509.UnknownAuthorityError{}}},
+		{name: "too many redirects", attempt: 1, err: &url.Error{Op: "Get", URL: "https://example.com/", Err: errors.New("stopped after 10 redirects")}},
+		{name: "dns failure", attempt: 1, err: &url.Error{Op: "Get", URL: "https://nx.invalid/", Err: &net.OpError{Op: "dial", Err: &net.DNSError{Err: "no such host", Name: "nx.invalid", IsNotFound: true}}}},
+		{name: "skipped", attempt: 1, err: errTooLarge},
+		{name: "other error", attempt: 1, err: errors.New("disk full")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, ok := p.retryDelay(tt.attempt, tt.err)
+			if ok != tt.retry {
+				t.Fatalf("retry = %v, want %v", ok, tt.retry)
+			}
+			if tt.exact > 0 && d != tt.exact {
+				t.Errorf("delay = %v, want %v", d, tt.exact)
+			}
+		})
+	}
+}
+
+func TestRetryFlow(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts = make(map[string]int)
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts[r.URL.Path]++
+		n := attempts[r.URL.Path]
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/flaky">flaky</a><a href="/busy">busy</a><a href="/gone">gone</a>`)
+		case "/flaky":
+			if n < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "ok")
+		case "/busy":
+			// Сервер просит подождать сутки; потолок MaxDelay не дает застрять
+			if n == 1 {
+				w.Header().Set("Retry-After", "86400")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, "ok")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL + "/")
+	retry := DefaultRetryPolicy()
+	retry.BaseDelay = 10 * time.Millisecond
+	retry.MaxDelay = 50 * time.Millisecond
+	c, err := NewCrawler(Config{BaseURL: base, Storage: NewMemoryStorage(), MaxDepth: 1, Concurrency: 2, Retry: retry})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]struct {
+		status   string
+		attempts int
+	}{
+		"/flaky": {outcomeSaved, 3},
+		"/busy":  {outcomeSaved, 2},
+		"/gone":  {outcomeFailed, 1},
+	}
+	for path, w := range want {
+		u, _ := url.Parse(srv.URL + path)
+		o := c.outcomes[c.key(u)]
+		if o.Status != w.status || o.Attempts != w.attempts {
+			t.Errorf("%s: status %s after %d attempts, want %s after %d", path, o.Status, o.Attempts, w.status, w.attempts)
+		}
+	}
+}
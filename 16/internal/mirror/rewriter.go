@@ -4,121 +4,249 @@ import (
 	"bytes"
 	"net/url"
 	"regexp"
+	"slices"
 	"strings"
 
 	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
 )
 
 // В Go нет бэкреференсов, поэтому три альтернативы:
 // 1) url('...') 2) url("...") 3) url(unquoted)
 var cssURLRe = regexp.MustCompile(`(?i)url\(\s*(?:'([^']*)'|"([^"]*)"|([^'")\s]+))\s*\)`)
 
-func rewriteHTMLAndDiscover(baseURL *url.URL, localPathForBase string, htmlBytes []byte, sameHostOnly bool) ([]byte, []discoveredLink, error) {
-	doc, err := html.Parse(bytes.NewReader(htmlBytes))
+// @import со строкой вместо url(): @import "a.css"; @import 'b.css' screen;
+var cssImportRe = regexp.MustCompile(`(?i)@import\s+(?:'([^']*)'|"([^"]*)")`)
+
+// <meta http-equiv="refresh" content="5; url=/next">
+var metaRefreshRe = regexp.MustCompile(`(?i)^(\s*\d*\.?\d*\s*[;,]\s*(?:url\s*=\s*)?)(['"]?)([^'"]*)(['"]?)(.*)$`)
+
+// linkRewriter переписывает ссылки одного документа на локальные относительные пути
+// и собирает найденные URL.
+// Какие из найденных URL скачивать, решает краулер (см. crawlScope).
+type linkRewriter struct {
+	base      *url.URL // относительно чего разрешаются ссылки — URL документа или <base href>
+	localBase string
+	pathFor   pathLookup
+	found     []discoveredLink
+	canonical *url.URL // из <link rel="canonical">, если есть
+}
+
+// pathLookup сопоставляет URL с локальным путем; false — файла в зеркале нет,
+// и ссылка становится абсолютной.
+type pathLookup func(*url.URL) (string, bool)
+
+// guessPath — догадка по URL без сведений о том, что скачано.
+func guessPath(u *url.URL) (string, bool) {
+	return localPathForURL(u), true
+}
+
+func newLinkRewriter(page *url.URL, localBase string, pathFor pathLookup) *linkRewriter {
+	if pathFor == nil {
+		pathFor = guessPath
+	}
+	return &linkRewriter{base: page, localBase: localBase, pathFor: pathFor}
+}
+
+// link возвращает ссылку вместо ref: локальную, если файл есть в зеркале, иначе
+// абсолютный URL. ok=false — ссылку оставляем как есть (пустая, data:, якорь).
+func (r *linkRewriter) link(ref string, kind ResourceKind) (string, bool) {
+	abs, ok := resolveURL(r.base, ref)
+	if !ok {
+		return "", false
+	}
+	r.found = append(r.found, discoveredLink{URL: abs, Kind: kind})
+	local, saved := r.pathFor(abs)
+	if !saved {
+		return abs.String(), true
+	}
+	rel := relativeLink(r.localBase, local)
+	// Якорь нужен и локально: page.html#section, sprite.svg#icon
+	if abs.Fragment != "" {
+		rel += "#" + abs.EscapedFragment()
+	}
+	return rel, true
+}
+
+func (r *linkRewriter) attr(a *html.Attribute, kind ResourceKind) {
+	if rel, ok := r.link(a.Val, kind); ok {
+		a.Val = rel
+	}
+}
+
+// srcset может содержать несколько URL с дескрипторами: "a.png 1x, b.png 2x"
+func (r *linkRewriter) srcset(val string) string {
+	var out []string
+	for _, p := range strings.Split(val, ",") {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		sub := strings.Fields(p)
+		rel, ok := r.link(sub[0], ResourceAsset)
+		if !ok {
+			out = append(out, p)
+			continue
+		}
+		out = append(out, strings.Join(append([]string{rel}, sub[1:]...), " "))
+	}
+	return strings.Join(out, ", ")
+}
+
+// css переписывает url(...) и @import "..." в таблице стилей или атрибуте style.
+func (r *linkRewriter) css(css []byte) []byte {
+	css = cssURLRe.ReplaceAllFunc(css, func(m []byte) []byte {
+		sub := cssURLRe.FindSubmatch(m)
+		// sub[0] — полное совпадение, дальше группы:
+		// 1 — одинарные кавычки, 2 — двойные, 3 — без кавычек
+		var raw, quote string
+		if len(sub[1]) > 0 {
+			raw, quote = string(sub[1]), "'"
+		} else if len(sub[2]) > 0 {
+			raw, quote = string(sub[2]), `"`
+		} else if len(sub[3]) > 0 {
+			raw = string(sub[3])
+		} else {
+			return m
+		}
+		rel, ok := r.link(raw, ResourceAsset)
+		if !ok {
+			return m
+		}
+		// Собрать обратно: сохраняем исходный тип кавычек
+		return []byte("url(" + quote + rel + quote + ")")
+	})
+	return cssImportRe.ReplaceAllFunc(css, func(m []byte) []byte {
+		sub := cssImportRe.FindSubmatch(m)
+		raw, quote := string(sub[1]), "'"
+		if len(sub[2]) > 0 {
+			raw, quote = string(sub[2]), `"`
+		}
+		rel, ok := r.link(raw, ResourceAsset)
+		if !ok {
+			return m
+		}
+		return []byte("@import " + quote + rel + quote)
+	})
+}
+
+// metaRefresh переписывает URL в content="N; url=..." у <meta http-equiv=refresh>.
+func (r *linkRewriter) metaRefresh(content string) string {
+	m := metaRefreshRe.FindStringSubmatch(content)
+	if m == nil || strings.TrimSpace(m[3]) == "" {
+		return content
+	}
+	rel, ok := r.link(m[3], ResourcePage)
+	if !ok {
+		return content
+	}
+	return m[1] + m[2] + rel + m[4] + m[5]
+}
+
+// rewriteHTMLAndDiscover переписывает ссылки HTML-документа; pathFor сопоставляет URL
+// с локальным путем (nil — догадка localPathForURL).
+func rewriteHTMLAndDiscover(baseURL *url.URL, localPathForBase string, htmlBytes []byte, pathFor pathLookup) ([]byte, []discoveredLink, error) {
+	r := newLinkRewriter(baseURL, localPathForBase, pathFor)
+	out, err := r.html(htmlBytes)
 	if err != nil {
 		return nil, nil, err
 	}
+	return out, r.found, nil
+}
+
+func (r *linkRewriter) html(htmlBytes []byte) ([]byte, error) {
+	doc, err := html.Parse(bytes.NewReader(htmlBytes))
+	if err != nil {
+		return nil, err
+	}
+	if b := findBaseHref(doc); b != "" {
+		if u, err := url.Parse(b); err == nil {
+			r.base = r.base.ResolveReference(u)
+		}
+	}
 
-	var found []discoveredLink
 	visitNode := func(n *html.Node) {
 		if n.Type != html.ElementNode {
 			return
 		}
-		switch strings.ToLower(n.Data) {
-		case "a":
-			// только ссылочные страницы
-			for i := range n.Attr {
-				if strings.EqualFold(n.Attr[i].Key, "href") {
-					val := strings.TrimSpace(n.Attr[i].Val)
-					abs, ok := resolveURL(baseURL, val)
-					if !ok {
-						continue
-					}
-					if sameHostOnly && !sameHost(baseURL, abs) {
-						continue
-					}
-					// предполагаем HTML-страницу
-					kind := ResourcePage
-					found = append(found, discoveredLink{URL: abs, Kind: kind})
-					toLocal := localPathForURL(abs)
-					n.Attr[i].Val = relativeLink(localPathForBase, toLocal)
+		tag := strings.ToLower(n.Data)
+
+		// <style>: содержимое — один текстовый узел, переписываем как CSS
+		if tag == "style" {
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.TextNode {
+					c.Data = string(r.css([]byte(c.Data)))
 				}
 			}
-		case "link":
-			var isStylesheet bool
-			for _, a := range n.Attr {
-				if strings.EqualFold(a.Key, "rel") && strings.Contains(strings.ToLower(a.Val), "stylesheet") {
-					isStylesheet = true
-					break
-				}
+		}
+
+		// Локальные ссылки относительны файла, <base href> их сломал бы
+		if tag == "base" {
+			n.Attr = slices.DeleteFunc(n.Attr, func(a html.Attribute) bool { return strings.EqualFold(a.Key, "href") })
+		}
+
+		isCanonical := tag == "link" && slices.Contains(strings.Fields(strings.ToLower(attrValue(n, "rel"))), "canonical")
+		isRefresh := tag == "meta" && strings.EqualFold(attrValue(n, "http-equiv"), "refresh")
+		isPostForm := tag == "form" && strings.EqualFold(strings.TrimSpace(attrValue(n, "method")), "post")
+
+		for i := range n.Attr {
+			a := &n.Attr[i]
+			key := strings.ToLower(a.Key)
+
+			// Атрибуты, которые встречаются у любых элементов
+			switch key {
+			case "style":
+				a.Val = string(r.css([]byte(a.Val)))
+				continue
+			case "data-src":
+				r.attr(a, ResourceAsset)
+				continue
+			case "data-srcset":
+				a.Val = r.srcset(a.Val)
+				continue
 			}
-			for i := range n.Attr {
-				if strings.EqualFold(n.Attr[i].Key, "href") {
-					val := strings.TrimSpace(n.Attr[i].Val)
-					abs, ok := resolveURL(baseURL, val)
-					if !ok {
-						continue
-					}
-					if sameHostOnly && !sameHost(baseURL, abs) {
-						continue
-					}
-					kind := ResourceAsset
-					if isStylesheet {
-						kind = ResourceAsset
-					}
-					found = append(found, discoveredLink{URL: abs, Kind: kind})
-					toLocal := localPathForURL(abs)
-					n.Attr[i].Val = relativeLink(localPathForBase, toLocal)
+
+			switch tag {
+			case "a", "area":
+				// ссылочные страницы; у <a> внутри SVG это xlink:href
+				if key == "href" {
+					r.attr(a, ResourcePage)
 				}
-			}
-		case "script", "img", "source", "video", "audio", "iframe":
-			for i := range n.Attr {
-				if strings.EqualFold(n.Attr[i].Key, "src") {
-					val := strings.TrimSpace(n.Attr[i].Val)
-					abs, ok := resolveURL(baseURL, val)
-					if !ok {
-						continue
-					}
-					if sameHostOnly && !sameHost(baseURL, abs) {
-						continue
+			case "link":
+				if key == "href" && isCanonical {
+					if u, ok := resolveURL(r.base, a.Val); ok {
+						r.canonical = u
 					}
-					found = append(found, discoveredLink{URL: abs, Kind: ResourceAsset})
-					toLocal := localPathForURL(abs)
-					n.Attr[i].Val = relativeLink(localPathForBase, toLocal)
+					r.attr(a, ResourcePage)
+				} else if key == "href" {
+					r.attr(a, ResourceAsset)
 				}
-				if strings.EqualFold(n.Attr[i].Key, "srcset") {
-					// srcset может содержать несколько URL
-					parts := strings.Split(n.Attr[i].Val, ",")
-					var out []string
-					for _, p := range parts {
-						p = strings.TrimSpace(p)
-						if p == "" {
-							continue
-						}
-						sub := strings.Fields(p)
-						if len(sub) == 0 {
-							continue
-						}
-						link := sub[0]
-						abs, ok := resolveURL(baseURL, link)
-						if !ok {
-							out = append(out, p)
-							continue
-						}
-						if sameHostOnly && !sameHost(baseURL, abs) {
-							out = append(out, p)
-							continue
-						}
-						found = append(found, discoveredLink{URL: abs, Kind: ResourceAsset})
-						toLocal := localPathForURL(abs)
-						rel := relativeLink(localPathForBase, toLocal)
-						if len(sub) > 1 {
-							out = append(out, strings.Join(append([]string{rel}, sub[1:]...), " "))
-						} else {
-							out = append(out, rel)
-						}
-					}
-					n.Attr[i].Val = strings.Join(out, ", ")
+			case "script", "img", "source", "video", "audio", "iframe", "embed", "track", "input":
+				switch key {
+				case "src":
+					r.attr(a, ResourceAsset)
+				case "srcset":
+					a.Val = r.srcset(a.Val)
+				case "poster":
+					r.attr(a, ResourceAsset)
+				}
+			case "object":
+				if key == "data" {
+					r.attr(a, ResourceAsset)
+				}
+			case "form":
+				// POST-формы GET-запросом не скачать — оставляем как есть
+				if key == "action" && !isPostForm {
+					r.attr(a, ResourcePage)
+				}
+			case "meta":
+				if key == "content" && isRefresh {
+					a.Val = r.metaRefresh(a.Val)
+				}
+			case "use", "image", "feimage":
+				// SVG: href или xlink:href (у последнего Namespace "xlink", Key "href")
+				if n.Namespace == "svg" && key == "href" {
+					r.attr(a, ResourceAsset)
 				}
 			}
 		}
@@ -135,9 +263,33 @@ func rewriteHTMLAndDiscover(baseURL *url.URL, localPathForBase string, htmlBytes
 
 	var buf bytes.Buffer
 	if err := html.Render(&buf, doc); err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	return buf.Bytes(), found, nil
+	return buf.Bytes(), nil
+}
+
+// findBaseHref — href первого <base> в документе (по HTML он действует на весь документ).
+func findBaseHref(n *html.Node) string {
+	if n.Type == html.ElementNode && n.DataAtom == atom.Base {
+		if href := strings.TrimSpace(attrValue(n, "href")); href != "" {
+			return href
+		}
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if href := findBaseHref(c); href != "" {
+			return href
+		}
+	}
+	return ""
+}
+
+func attrValue(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
 }
 
 func resolveURL(base *url.URL, ref string) (*url.URL, bool) {
@@ -149,68 +301,16 @@ func resolveURL(base *url.URL, ref string) (*url.URL, bool) {
 	if err != nil {
 		return nil, false
 	}
-	return base.ResolveReference(u), true
-}
-
-func rewriteCSSAndDiscover(baseURL *url.URL, localPathForBase string, css []byte, sameHostOnly bool) ([]byte, []discoveredLink) {
-	rewritten := cssURLRe.ReplaceAllFunc(css, func(m []byte) []byte {
-		sub := cssURLRe.FindSubmatch(m)
-		// sub[0] — полное совпадение, дальше группы:
-		// 1 — одинарные кавычки, 2 — двойные, 3 — без кавычек
-		var raw, quote string
-		if len(sub) >= 2 && len(sub[1]) > 0 {
-			raw = string(sub[1])
-			quote = "'"
-		} else if len(sub) >= 3 && len(sub[2]) > 0 {
-			raw = string(sub[2])
-			quote = `"`
-		} else if len(sub) >= 4 && len(sub[3]) > 0 {
-			raw = string(sub[3])
-			quote = ""
-		} else {
-			return m
-		}
-		abs, ok := resolveURL(baseURL, raw)
-		if !ok {
-			return m
-		}
-		if sameHostOnly && !sameHost(baseURL, abs) {
-			return m
-		}
-		local := localPathForURL(abs)
-		rel := relativeLink(localPathForBase, local)
-
-		// Собрать обратно: сохраняем исходный тип кавычек
-		if quote == "" {
-			return []byte("url(" + rel + ")")
-		}
-		return []byte("url(" + quote + rel + quote + ")")
-	})
-	return rewritten, discoverCSSURLs(baseURL, rewritten, sameHostOnly)
+	// tel:, ftp: и прочие схемы не скачать и не проверить по HTTP — оставляем как есть
+	abs := base.ResolveReference(u)
+	if !isHTTPURL(abs) {
+		return nil, false
+	}
+	return abs, true
 }
 
-func discoverCSSURLs(base *url.URL, css []byte, sameHostOnly bool) []discoveredLink {
-	matches := cssURLRe.FindAllSubmatch(css, -1)
-	var out []discoveredLink
-	for _, m := range matches {
-		var raw string
-		if len(m) >= 2 && len(m[1]) > 0 {
-			raw = string(m[1])
-		} else if len(m) >= 3 && len(m[2]) > 0 {
-			raw = string(m[2])
-		} else if len(m) >= 4 && len(m[3]) > 0 {
-			raw = string(m[3])
-		} else {
-			continue
-		}
-		abs, ok := resolveURL(base, raw)
-		if !ok {
-			continue
-		}
-		if sameHostOnly && !sameHost(base, abs) {
-			continue
-		}
-		out = append(out, discoveredLink{URL: abs, Kind: ResourceAsset})
-	}
-	return out
+// rewriteCSSAndDiscover переписывает url(...) и @import в таблице стилей.
+func rewriteCSSAndDiscover(baseURL *url.URL, localPathForBase string, css []byte, pathFor pathLookup) ([]byte, []discoveredLink) {
+	r := newLinkRewriter(baseURL, localPathForBase, pathFor)
+	return r.css(css), r.found
 }
@@ -0,0 +1,104 @@
+package mirror
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestRewriteHTMLReferences(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/page.html")
+	localBase := localPathForURL(base)
+
+	tests := []struct {
+		name  string
+		html  string
+		found string // URL, который должен быть найден
+		kind  ResourceKind
+		want  string // фрагмент переписанного HTML
+	}{
+		{name: "style attribute", html: `<div style="background: url('/img/bg.png')"></div>`,
+			found: "https://example.com/img/bg.png", kind: ResourceAsset, want: `url(&#39;../img/bg.png&#39;)`},
+		{name: "style block", html: `<style>body { background: url(bg.png) }</style>`,
+			found: "https://example.com/docs/bg.png", kind: ResourceAsset, want: `url(bg.png)`},
+		{name: "import without url()", html: `<style>@import "theme.css" screen;</style>`,
+			found: "https://example.com/docs/theme.css", kind: ResourceAsset, want: `@import "theme.css" screen;`},
+		{name: "meta refresh", html: `<meta http-equiv="refresh" content="0; URL='/next/'">`,
+			found: "https://example.com/next/", kind: ResourcePage, want: `content="0; URL=&#39;../next/index.html&#39;"`},
+		{name: "video poster", html: `<video poster="/p.jpg"></video>`,
+			found: "https://example.com/p.jpg", kind: ResourceAsset, want: `poster="../p.jpg"`},
+		{name: "object data", html: `<object data="movie.swf"></object>`,
+			found: "https://example.com/docs/movie.swf", kind: ResourceAsset, want: `data="movie.swf"`},
+		{name: "embed src", html: `<embed src="/e.svg">`,
+			found: "https://example.com/e.svg", kind: ResourceAsset, want: `src="../e.svg"`},
+		{name: "get form action", html: `<form action="/search"></form>`,
+			found: "https://example.com/search", kind: ResourcePage, want: `action="../search/index.html"`},
+		{name: "picture source srcset", html: `<picture><source srcset="a.webp 1x, b.webp 2x"><img src="a.png"></picture>`,
+			found: "https://example.com/docs/b.webp", kind: ResourceAsset, want: `srcset="a.webp 1x, b.webp 2x"`},
+		{name: "lazy data-src", html: `<img data-src="/lazy.png">`,
+			found: "https://example.com/lazy.png", kind: ResourceAsset, want: `data-src="../lazy.png"`},
+		{name: "lazy data-srcset", html: `<img data-srcset="/l1.png 100w, /l2.png 200w">`,
+			found: "https://example.com/l2.png", kind: ResourceAsset, want: `data-srcset="../l1.png 100w, ../l2.png 200w"`},
+		{name: "svg use href keeps fragment", html: `<svg><use href="/icons.svg#home"></use></svg>`,
+			found: "https://example.com/icons.svg#home", kind: ResourceAsset, want: `href="../icons.svg#home"`},
+		{name: "svg use xlink:href", html: `<svg><use xlink:href="/icons.svg#x"></use></svg>`,
+			found: "https://example.com/icons.svg#x", kind: ResourceAsset, want: `xlink:href="../icons.svg#x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, links, err := rewriteHTMLAndDiscover(base, localBase, []byte(tt.html), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got bool
+			for _, dl := range links {
+				if dl.URL.String() == tt.found {
+					got = true
+					if dl.Kind != tt.kind {
+						t.Errorf("kind(%s) = %v, want %v", tt.found, dl.Kind, tt.kind)
+					}
+				}
+			}
+			if !got {
+				t.Errorf("%s not discovered in %v", tt.found, links)
+			}
+			if !strings.Contains(string(out), tt.want) {
+				t.Errorf("output %s does not contain %s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestRewriteHTMLLeavesPostForms(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+	_, links, err := rewriteHTMLAndDiscover(base, localPathForURL(base), []byte(`<form method="POST" action="/login"></form>`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 0 {
+		t.Errorf("POST form action discovered: %v", links)
+	}
+}
+
+func TestRewriteHTMLUnsavedLinksAbsolute(t *testing.T) {
+	base, _ := url.Parse("https://example.com/docs/")
+	saved := map[string]string{"https://example.com/docs/a.html": "example.com/docs/a.html"}
+	pathFor := func(u *url.URL) (string, bool) {
+		p, ok := saved[urlKey(u)]
+		return p, ok
+	}
+	src := `<base href="/docs/"><a href="a.html#top">a</a><a href="deep/b.html">b</a><img src="//cdn.example.net/x.png">`
+	out, _, err := rewriteHTMLAndDiscover(base, "example.com/docs/index.html", []byte(src), pathFor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`href="a.html#top"`,
+		`href="https://example.com/docs/deep/b.html"`,
+		`src="https://cdn.example.net/x.png"`,
+	} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("output %s does not contain %s", out, want)
+		}
+	}
+}
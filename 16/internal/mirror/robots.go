@@ -2,72 +2,161 @@ package mirror
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"net/url"
 	"path"
+	"regexp"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
-// Минимальная поддержка robots.txt для User-agent: *.
-// Реализована логика "самого длинного совпадения"; при равной длине Allow побеждает Disallow.
+// Поддержка robots.txt по RFC 9309: группы по User-agent (выбирается самая конкретная
+// для нашего продукта, иначе "*"), шаблоны с "*" и "$", правило самого длинного совпадения
+// (при равной длине Allow побеждает Disallow). Пути сравниваются с учетом регистра.
 type robotRule struct {
-	allow    bool
-	prefix   string
-	prefixLC string
+	allow   bool
+	pattern string
+	re      *regexp.Regexp // nil, если в шаблоне нет "*" и "$" — тогда это простой префикс
+}
+
+type robotsGroup struct {
+	agents     []string // в нижнем регистре
+	rules      []robotRule
+	crawlDelay time.Duration
 }
 
 type robotsHostRules struct {
-	loaded bool
-	rules  []robotRule
+	disallowAll bool // robots.txt недоступен (5xx, сетевая ошибка) — RFC 9309, 2.3.1.4
+	rules       []robotRule
+	crawlDelay  time.Duration
+	sitemaps    []string
+	// expires — когда запросить robots.txt снова; нулевое — правила действуют весь обход.
+	// Недоступность считается временной: один сбой сети не должен закрыть весь сайт
+	expires time.Time
 }
 
+// robotsRetryInterval — через сколько повторить запрос недоступного robots.txt.
+const robotsRetryInterval = time.Minute
+
 type robotsManager struct {
-	mu    sync.Mutex
-	cache map[string]*robotsHostRules
+	mu      sync.Mutex
+	cache   map[string]*robotsHostRules
+	product string        // токен продукта из User-Agent, в нижнем регистре
+	retry   time.Duration // сколько считать недоступный robots.txt запрещающим всё
 }
 
-func newRobotsManager() *robotsManager {
+func newRobotsManager(userAgent string) *robotsManager {
 	return &robotsManager{
-		cache: make(map[string]*robotsHostRules),
+		cache:   make(map[string]*robotsHostRules),
+		product: productToken(userAgent),
+		retry:   robotsRetryInterval,
+	}
+}
+
+// productToken выделяет токен продукта: "site-mirror/1.0 (+https://...)" -> "site-mirror".
+func productToken(userAgent string) string {
+	token, _, _ := strings.Cut(strings.TrimSpace(userAgent), "/")
+	token, _, _ = strings.Cut(token, " ")
+	return strings.ToLower(token)
+}
+
+// allowed сообщает, разрешен ли URL. Ошибка возвращается только при отмене контекста:
+// тогда о robots.txt ничего не известно и решать за сайт нельзя.
+func (rm *robotsManager) allowed(u *url.URL, fetch fetchText) (bool, error) {
+	// Сам robots.txt разрешен всегда
+	if u.EscapedPath() == "/robots.txt" {
+		return true, nil
+	}
+	entry, err := rm.load(u, fetch)
+	if err != nil {
+		return false, err
 	}
+	if entry.disallowAll {
+		return false, nil
+	}
+	return matchAllowed(u, entry.rules), nil
 }
 
-func (rm *robotsManager) allowed(u *url.URL, fetch fetchText) bool {
+// crawlDelay возвращает Crawl-delay из robots.txt хоста (0, если не задан).
+func (rm *robotsManager) crawlDelay(u *url.URL, fetch fetchText) time.Duration {
+	entry, err := rm.load(u, fetch)
+	if err != nil {
+		return 0
+	}
+	return entry.crawlDelay
+}
+
+// sitemaps возвращает URL из строк Sitemap: в robots.txt хоста.
+func (rm *robotsManager) sitemaps(u *url.URL, fetch fetchText) []string {
+	entry, err := rm.load(u, fetch)
+	if err != nil {
+		return nil
+	}
+	return entry.sitemaps
+}
+
+func (rm *robotsManager) load(u *url.URL, fetch fetchText) (*robotsHostRules, error) {
 	host := strings.ToLower(u.Host)
 	rm.mu.Lock()
 	entry, ok := rm.cache[host]
 	rm.mu.Unlock()
+	if ok && (entry.expires.IsZero() || time.Now().Before(entry.expires)) {
+		return entry, nil
+	}
 
-	if !ok || !entry.loaded {
-		// загрузим/распарсим
-		rules := rm.fetchAndParse(u, fetch)
-		rm.mu.Lock()
-		rm.cache[host] = &robotsHostRules{loaded: true, rules: rules}
-		entry = rm.cache[host]
-		rm.mu.Unlock()
+	entry, err := rm.fetchAndParse(u, fetch)
+	if err != nil {
+		return nil, err
 	}
-	return matchAllowed(u, entry.rules)
+	rm.mu.Lock()
+	rm.cache[host] = entry
+	rm.mu.Unlock()
+	return entry, nil
 }
 
-type fetchText func(robotsURL string) ([]byte, error)
+// fetchText скачивает robots.txt и возвращает HTTP-статус и тело.
+type fetchText func(robotsURL string) (int, []byte, error)
 
-func (rm *robotsManager) fetchAndParse(u *url.URL, fetch fetchText) []robotRule {
+func (rm *robotsManager) fetchAndParse(u *url.URL, fetch fetchText) (*robotsHostRules, error) {
 	rURL := *u
 	rURL.Path = path.Join("/", "robots.txt")
+	rURL.RawPath = ""
 	rURL.RawQuery = ""
 	rURL.Fragment = ""
-	body, err := fetch(rURL.String())
-	if err != nil || len(body) == 0 {
-		return nil
+	status, body, err := fetch(rURL.String())
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		// Обход остановлен, а не сайт недоступен — в кэш не попадает
+		return nil, err
+	case err != nil || status >= 500:
+		// Недоступен: пока считаем, что запрещено всё, и через retry спросим снова
+		return &robotsHostRules{disallowAll: true, expires: time.Now().Add(rm.retry)}, nil
+	case status >= 400:
+		// Нет robots.txt: разрешено всё
+		return &robotsHostRules{}, nil
 	}
-	return parseRobots(body)
+
+	groups, sitemaps := parseRobots(body)
+	entry := &robotsHostRules{sitemaps: sitemaps}
+	for _, g := range selectGroups(groups, rm.product) {
+		entry.rules = append(entry.rules, g.rules...)
+		entry.crawlDelay = max(entry.crawlDelay, g.crawlDelay)
+	}
+	return entry, nil
 }
 
-func parseRobots(b []byte) []robotRule {
+func parseRobots(b []byte) ([]robotsGroup, []string) {
 	lines := bytes.Split(b, []byte{'\n'})
 	var (
-		activeUAStar bool
-		rules        []robotRule
+		groups   []robotsGroup
+		sitemaps []string
+		cur      *robotsGroup
+		// подряд идущие строки User-agent относятся к одной группе
+		inAgents bool
 	)
 	for _, ln := range lines {
 		line := string(ln)
@@ -86,44 +175,146 @@ func parseRobots(b []byte) []robotRule {
 		val = strings.TrimSpace(val)
 		switch key {
 		case "user-agent":
-			ua := strings.ToLower(val)
-			// начинаем секцию для * если встречаем ее; если лучшие секции (конкретнее) тоже встретятся — в этой минимальной реализации мы используем только '*'
-			activeUAStar = (ua == "*")
-		case "allow":
-			if activeUAStar {
-				p := val
-				rules = append(rules, robotRule{allow: true, prefix: p, prefixLC: strings.ToLower(p)})
+			if !inAgents {
+				groups = append(groups, robotsGroup{})
+				cur = &groups[len(groups)-1]
+			}
+			cur.agents = append(cur.agents, strings.ToLower(val))
+			inAgents = true
+		case "allow", "disallow":
+			inAgents = false
+			if cur == nil {
+				continue
+			}
+			// Disallow:  (пусто) — ничего не запрещает; Allow:  — тоже
+			if val == "" {
+				continue
+			}
+			cur.rules = append(cur.rules, newRobotRule(key == "allow", val))
+		case "crawl-delay":
+			// Нестандартная, но распространенная директива; значение в секундах, может быть дробным
+			inAgents = false
+			if cur == nil {
+				continue
+			}
+			if secs, err := strconv.ParseFloat(val, 64); err == nil && secs > 0 {
+				cur.crawlDelay = time.Duration(secs * float64(time.Second))
 			}
-		case "disallow":
-			if activeUAStar {
-				p := val
-				rules = append(rules, robotRule{allow: false, prefix: p, prefixLC: strings.ToLower(p)})
+		case "sitemap":
+			// Sitemap не относится к группам
+			if val != "" {
+				sitemaps = append(sitemaps, val)
 			}
+		default:
+			inAgents = false
 		}
 	}
-	return rules
+	return groups, sitemaps
+}
+
+// selectGroups выбирает группы для нашего продукта: User-agent совпадает с токеном продукта
+// целиком без учета регистра (RFC 9309, 2.2.1 — "go" не относится к "googlebot"),
+// иначе группы "*". Группы с одинаковым User-agent объединяются.
+func selectGroups(groups []robotsGroup, product string) []robotsGroup {
+	best := "*"
+	for _, g := range groups {
+		for _, a := range g.agents {
+			if product != "" && a == product {
+				best = a
+			}
+		}
+	}
+	var out []robotsGroup
+	for _, g := range groups {
+		for _, a := range g.agents {
+			if a == best {
+				out = append(out, g)
+				break
+			}
+		}
+	}
+	return out
+}
+
+func newRobotRule(allow bool, pattern string) robotRule {
+	pattern = normalizeRobotsPath(pattern)
+	r := robotRule{allow: allow, pattern: pattern}
+	if !strings.ContainsAny(pattern, "*$") {
+		return r
+	}
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i, ch := range pattern {
+		switch {
+		case ch == '*':
+			sb.WriteString(".*")
+		case ch == '$' && i == len(pattern)-1:
+			// "$" значим только в конце шаблона
+			sb.WriteString("$")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(ch)))
+		}
+	}
+	r.re = regexp.MustCompile(sb.String())
+	return r
+}
+
+func (r robotRule) match(target string) bool {
+	if r.re != nil {
+		return r.re.MatchString(target)
+	}
+	return strings.HasPrefix(target, r.pattern)
+}
+
+// normalizeRobotsPath приводит путь к единому виду для сравнения: не-ASCII символы
+// кодируются процентами, шестнадцатеричные цифры в %XX — в верхнем регистре.
+func normalizeRobotsPath(p string) string {
+	var sb strings.Builder
+	for i := 0; i < len(p); i++ {
+		ch := p[i]
+		switch {
+		case ch == '%' && i+2 < len(p) && isHex(p[i+1]) && isHex(p[i+2]):
+			sb.WriteByte('%')
+			sb.WriteString(strings.ToUpper(p[i+1 : i+3]))
+			i += 2
+		case ch >= 0x80 || ch == ' ':
+			fmt.Fprintf(&sb, "%%%02X", ch)
+		default:
+			sb.WriteByte(ch)
+		}
+	}
+	return sb.String()
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
 }
 
 func matchAllowed(u *url.URL, rules []robotRule) bool {
 	if len(rules) == 0 {
 		return true
 	}
-	target := strings.ToLower(u.EscapedPath())
+	// Правила применяются к пути вместе с query
+	target := u.EscapedPath()
+	if target == "" {
+		target = "/"
+	}
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+	target = normalizeRobotsPath(target)
+
 	var (
 		bestLen   = -1
 		bestAllow = true // по умолчанию allow
 	)
 	for _, r := range rules {
-		p := r.prefixLC
-		if p == "" {
-			// Disallow:  (пусто) — означает разрешено всё; Allow:  — тоже.
+		if !r.match(target) {
 			continue
 		}
-		if strings.HasPrefix(target, p) {
-			if ll := len(p); ll > bestLen || (ll == bestLen && r.allow) {
-				bestLen = ll
-				bestAllow = r.allow
-			}
+		if ll := len(r.pattern); ll > bestLen || (ll == bestLen && r.allow) {
+			bestLen = ll
+			bestAllow = r.allow
 		}
 	}
 	return bestAllow
@@ -0,0 +1,168 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRobotsAllowed(t *testing.T) {
+	const robotsTxt = `
+User-agent: *
+Disallow: /private/
+Disallow: /*.pdf$
+Allow: /private/public
+
+User-agent: other-bot
+User-agent: site-mirror
+Disallow: /Secret
+Allow: /Secret/open$
+Crawl-delay: 1.5
+
+Sitemap: https://example.com/sitemap.xml
+`
+	tests := []struct {
+		name    string
+		ua      string
+		path    string
+		allowed bool
+	}{
+		{name: "star group: disallowed prefix", ua: "generic/1.0", path: "/private/x", allowed: false},
+		{name: "star group: longer allow wins", ua: "generic/1.0", path: "/private/public/x", allowed: true},
+		{name: "star group: $ anchor matches", ua: "generic/1.0", path: "/docs/a.pdf", allowed: false},
+		{name: "star group: $ anchor does not match", ua: "generic/1.0", path: "/docs/a.pdf?x=1", allowed: true},
+		{name: "own group replaces star group", ua: "site-mirror/1.0 (+https://example.local)", path: "/private/x", allowed: true},
+		{name: "own group: case-sensitive", ua: "site-mirror/1.0", path: "/secret", allowed: true},
+		{name: "own group: disallowed", ua: "site-mirror/1.0", path: "/Secret/x", allowed: false},
+		{name: "own group: exact allow", ua: "site-mirror/1.0", path: "/Secret/open", allowed: true},
+		{name: "robots.txt always allowed", ua: "site-mirror/1.0", path: "/robots.txt", allowed: true},
+	}
+
+	fetch := func(string) (int, []byte, error) { return 200, []byte(robotsTxt), nil }
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm := newRobotsManager(tt.ua)
+			u, _ := url.Parse("https://example.com" + tt.path)
+			if got, _ := rm.allowed(u, fetch); got != tt.allowed {
+				t.Errorf("allowed(%s) = %v, want %v", tt.path, got, tt.allowed)
+			}
+		})
+	}
+
+	rm := newRobotsManager("site-mirror/1.0")
+	u, _ := url.Parse("https://example.com/")
+	if got := rm.crawlDelay(u, fetch); got != 1500*time.Millisecond {
+		t.Errorf("crawlDelay = %v, want 1.5s", got)
+	}
+	if got := rm.sitemaps(u, fetch); len(got) != 1 || got[0] != "https://example.com/sitemap.xml" {
+		t.Errorf("sitemaps = %v", got)
+	}
+}
+
+func TestRobotsFetchStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		allowed bool
+	}{
+		{name: "4xx allows all", status: 404, allowed: true},
+		{name: "5xx disallows all", status: 503, allowed: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rm := newRobotsManager("site-mirror/1.0")
+			u, _ := url.Parse("https://example.com/page")
+			fetch := func(string) (int, []byte, error) { return tt.status, nil, nil }
+			if got, _ := rm.allowed(u, fetch); got != tt.allowed {
+				t.Errorf("allowed = %v, want %v", got, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestRobotsAgentMatch(t *testing.T) {
+	const robotsTxt = `
+User-agent: site
+Disallow: /
+
+User-agent: SITE-MIRROR
+Disallow: /own
+
+User-agent: *
+Disallow: /star
+`
+	tests := []struct {
+		ua      string
+		path    string
+		allowed bool
+	}{
+		// "site" — лишь префикс токена "site-mirror", эта группа не наша
+		{ua: "site-mirror/1.0", path: "/page", allowed: true},
+		{ua: "site-mirror/1.0", path: "/own", allowed: false},
+		{ua: "Site-Mirror/2.0", path: "/own", allowed: false},
+		{ua: "site-mirror/1.0", path: "/star", allowed: true},
+		{ua: "go/1.0", path: "/star", allowed: false},
+		{ua: "Site/1.0", path: "/page", allowed: false},
+	}
+	fetch := func(string) (int, []byte, error) { return 200, []byte(robotsTxt), nil }
+	for _, tt := range tests {
+		rm := newRobotsManager(tt.ua)
+		u, _ := url.Parse("https://example.com" + tt.path)
+		if got, _ := rm.allowed(u, fetch); got != tt.allowed {
+			t.Errorf("%s: allowed(%s) = %v, want %v", tt.ua, tt.path, got, tt.allowed)
+		}
+	}
+}
+
+func TestRobotsUnreachable(t *testing.T) {
+	u, _ := url.Parse("https://example.com/page")
+	calls := 0
+	fail := true
+	fetch := func(string) (int, []byte, error) {
+		calls++
+		if fail {
+			return 0, nil, fmt.Errorf("dial tcp: connection refused")
+		}
+		return 404, nil, nil
+	}
+
+	rm := newRobotsManager("site-mirror/1.0")
+	if got, err := rm.allowed(u, fetch); got || err != nil {
+		t.Fatalf("unreachable robots.txt: allowed = %v, %v, want false, nil", got, err)
+	}
+	// До истечения интервала повторно не запрашиваем
+	rm.allowed(u, fetch)
+	if calls != 1 {
+		t.Errorf("robots.txt fetched %d times within retry interval", calls)
+	}
+	// Сбой временный: по истечении интервала robots.txt запрашивается снова
+	rm.mu.Lock()
+	rm.cache["example.com"].expires = time.Now().Add(-time.Second)
+	rm.mu.Unlock()
+	fail = false
+	if got, err := rm.allowed(u, fetch); !got || err != nil {
+		t.Errorf("after recovery: allowed = %v, %v, want true, nil", got, err)
+	}
+	if calls != 2 {
+		t.Errorf("robots.txt fetched %d times, want 2", calls)
+	}
+}
+
+func TestRobotsCancelled(t *testing.T) {
+	u, _ := url.Parse("https://example.com/page")
+	rm := newRobotsManager("site-mirror/1.0")
+	cancelled := func(string) (int, []byte, error) {
+		return 0, nil, fmt.Errorf("get robots.txt: %w", context.Canceled)
+	}
+	if _, err := rm.allowed(u, cancelled); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	// Отмена не запоминается как "запрещено всё"
+	ok := func(string) (int, []byte, error) { return 200, []byte("User-agent: *\nDisallow: /private\n"), nil }
+	if got, err := rm.allowed(u, ok); !got || err != nil {
+		t.Errorf("after cancel: allowed = %v, %v, want true, nil", got, err)
+	}
+}
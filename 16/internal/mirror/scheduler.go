@@ -0,0 +1,102 @@
+package mirror
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hostScheduler ограничивает нагрузку на каждый хост: не больше maxConns одновременных
+// запросов и не чаще одного запроса в interval (из RPS или Crawl-delay, что строже).
+type hostScheduler struct {
+	mu       sync.Mutex
+	hosts    map[string]*hostSlot
+	maxConns int
+	interval time.Duration
+}
+
+type hostSlot struct {
+	sem  chan struct{}
+	mu   sync.Mutex
+	next time.Time // раньше этого момента следующий запрос не начинать
+}
+
+func newHostScheduler(maxConns int, rps float64) *hostScheduler {
+	var interval time.Duration
+	if rps > 0 {
+		interval = time.Duration(float64(time.Second) / rps)
+	}
+	return &hostScheduler{
+		hosts:    make(map[string]*hostSlot),
+		maxConns: maxConns,
+		interval: interval,
+	}
+}
+
+func (s *hostScheduler) slot(host string) *hostSlot {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	hs, ok := s.hosts[host]
+	if !ok {
+		hs = &hostSlot{}
+		if s.maxConns > 0 {
+			hs.sem = make(chan struct{}, s.maxConns)
+		}
+		s.hosts[host] = hs
+	}
+	return hs
+}
+
+// acquire ждет разрешения на запрос к host. crawlDelay — задержка из robots.txt для хоста.
+// Возвращенную функцию нужно вызвать по окончании запроса.
+func (s *hostScheduler) acquire(ctx context.Context, host string, crawlDelay time.Duration) (func(), error) {
+	hs := s.slot(strings.ToLower(host))
+
+	if hs.sem != nil {
+		select {
+		case hs.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	release := func() {
+		if hs.sem != nil {
+			<-hs.sem
+		}
+	}
+
+	// Резервируем ближайший свободный момент и ждем его. Ждать приходится и без
+	// интервала: backoff по Retry-After сдвигает hs.next независимо от RPS
+	interval := max(s.interval, crawlDelay)
+	hs.mu.Lock()
+	now := time.Now()
+	start := hs.next
+	if start.Before(now) {
+		start = now
+	}
+	hs.next = start.Add(interval)
+	hs.mu.Unlock()
+
+	if wait := time.Until(start); wait > 0 {
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			release()
+			return nil, ctx.Err()
+		}
+	}
+	return release, nil
+}
+
+// backoff откладывает следующие запросы к host до until (Retry-After от сервера).
+func (s *hostScheduler) backoff(host string, until time.Time) {
+	hs := s.slot(strings.ToLower(host))
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if until.After(hs.next) {
+		hs.next = until
+	}
+}
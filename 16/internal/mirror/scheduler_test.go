@@ -0,0 +1,49 @@
+package mirror
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSchedulerBackoffWithoutInterval(t *testing.T) {
+	// Ни RPS, ни Crawl-delay: Retry-After все равно должен задерживать запросы
+	s := newHostScheduler(0, 0)
+	s.backoff("Example.com", time.Now().Add(100*time.Millisecond))
+
+	start := time.Now()
+	release, err := s.acquire(context.Background(), "example.com", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if waited := time.Since(start); waited < 90*time.Millisecond {
+		t.Errorf("acquire returned after %v, backoff ignored", waited)
+	}
+
+	// Другой хост backoff не касается
+	start = time.Now()
+	release, err = s.acquire(context.Background(), "other.example", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if waited := time.Since(start); waited > 50*time.Millisecond {
+		t.Errorf("unrelated host waited %v", waited)
+	}
+}
+
+func TestSchedulerBackoffCancel(t *testing.T) {
+	s := newHostScheduler(1, 0)
+	s.backoff("example.com", time.Now().Add(time.Hour))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.acquire(ctx, "example.com", 0); err == nil {
+		t.Fatal("acquire ignored cancelled context")
+	}
+	// Слот соединения освобожден при отмене
+	hs := s.slot("example.com")
+	if len(hs.sem) != 0 {
+		t.Errorf("connection slot leaked: %d in use", len(hs.sem))
+	}
+}
@@ -0,0 +1,151 @@
+package mirror
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// По протоколу sitemap не больше 50 МБ в распакованном виде
+	maxSitemapSize = 50 << 20
+	// Индексы sitemap могут ссылаться на индексы; дальше этой глубины не идем
+	maxSitemapNesting = 3
+)
+
+type sitemapDoc struct {
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	Lastmod string `xml:"lastmod"`
+}
+
+// seedFromSitemaps ставит в очередь страницы из /sitemap.xml и sitemap-ов из robots.txt,
+// включая индексы sitemap и сжатые gzip файлы.
+func (c *Crawler) seedFromSitemaps(ctx context.Context) {
+	root := &url.URL{Scheme: c.base.Scheme, Host: c.base.Host, Path: "/sitemap.xml"}
+	queue := []string{root.String()}
+	queue = append(queue, c.robots.sitemaps(c.base, c.robotsFetcher(ctx))...)
+
+	seen := make(map[string]bool)
+	added := 0
+	for depth := 0; depth < maxSitemapNesting && len(queue) > 0; depth++ {
+		var next []string
+		for _, sm := range queue {
+			if seen[sm] || ctx.Err() != nil {
+				continue
+			}
+			seen[sm] = true
+
+			doc, err := c.fetchSitemap(ctx, sm)
+			if err != nil {
+				log.Printf("Sitemap %s: %v", sm, err)
+				continue
+			}
+			if doc == nil {
+				continue
+			}
+			for _, e := range doc.Sitemaps {
+				if loc := strings.TrimSpace(e.Loc); loc != "" {
+					next = append(next, loc)
+				}
+			}
+			for _, e := range doc.URLs {
+				u, err := url.Parse(strings.TrimSpace(e.Loc))
+				if err != nil || !isHTTPURL(u) {
+					continue
+				}
+				if !c.scope.pageAllowed(u) {
+					continue
+				}
+				if !c.urlFilter.allowed(u, ResourcePage) {
+					continue
+				}
+				t := task{URL: u, DepthLeft: c.cfg.MaxDepth, Kind: ResourcePage, Lastmod: parseLastmod(e.Lastmod)}
+				t.From, _ = url.Parse(sm)
+				if c.enqueue(t) {
+					added++
+				}
+			}
+		}
+		queue = next
+	}
+	if added > 0 {
+		log.Printf("Из sitemap добавлено %d URL", added)
+	}
+}
+
+// fetchSitemap скачивает и разбирает sitemap; для отсутствующего или запрещенного robots.txt
+// файла возвращает nil без ошибки. Запрос подчиняется тем же правилам вежливости, что и обход.
+func (c *Crawler) fetchSitemap(ctx context.Context, sitemapURL string) (*sitemapDoc, error) {
+	u, err := url.Parse(sitemapURL)
+	if err != nil {
+		return nil, err
+	}
+	var crawlDelay time.Duration
+	if c.cfg.RespectRobots {
+		ok, err := c.robots.allowed(u, c.robotsFetcher(ctx))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			log.Printf("robots.txt запретил: %s", u)
+			return nil, nil
+		}
+		crawlDelay = c.robots.crawlDelay(u, c.robotsFetcher(ctx))
+	}
+	release, err := c.sched.acquire(ctx, u.Host, crawlDelay)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.httpc.GetText(ctx, sitemapURL, maxSitemapSize)
+	release()
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != 200 {
+		return nil, nil
+	}
+	return parseSitemap(res.Body)
+}
+
+// parseSitemap разбирает urlset или sitemapindex, при необходимости распаковывая gzip.
+func parseSitemap(body []byte) (*sitemapDoc, error) {
+	// .xml.gz обычно отдается как application/gzip без Content-Encoding — распаковываем сами
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		body, err = io.ReadAll(io.LimitReader(zr, maxSitemapSize))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var doc sitemapDoc
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// parseLastmod разбирает дату в формате W3C Datetime; при ошибке возвращает нулевое время.
+func parseLastmod(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04Z07:00", "2006-01-02", "2006-01", "2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
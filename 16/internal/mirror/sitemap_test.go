@@ -0,0 +1,128 @@
+package mirror
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testURLSet = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url><loc> https://example.com/a </loc><lastmod>2024-03-01</lastmod></url>
+  <url><loc>https://example.com/b</loc></url>
+</urlset>`
+
+func TestParseSitemap(t *testing.T) {
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write([]byte(testURLSet))
+	zw.Close()
+
+	for name, body := range map[string][]byte{"plain": []byte(testURLSet), "gzip": gz.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			doc, err := parseSitemap(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(doc.URLs) != 2 || len(doc.Sitemaps) != 0 {
+				t.Fatalf("got %d urls, %d sitemaps", len(doc.URLs), len(doc.Sitemaps))
+			}
+			if doc.URLs[0].Lastmod != "2024-03-01" || doc.URLs[1].Lastmod != "" {
+				t.Errorf("lastmod = %q, %q", doc.URLs[0].Lastmod, doc.URLs[1].Lastmod)
+			}
+		})
+	}
+
+	index := `<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>https://example.com/s1.xml.gz</loc><lastmod>2024-03-01T10:00:00Z</lastmod></sitemap>
+  <sitemap><loc>https://example.com/s2.xml</loc></sitemap>
+</sitemapindex>`
+	doc, err := parseSitemap([]byte(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Sitemaps) != 2 || doc.Sitemaps[0].Loc != "https://example.com/s1.xml.gz" || len(doc.URLs) != 0 {
+		t.Errorf("sitemapindex parsed as %+v", doc)
+	}
+
+	if _, err := parseSitemap([]byte("<urlset><url>")); err == nil {
+		t.Error("truncated sitemap accepted")
+	}
+}
+
+func TestParseLastmod(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2024-03-01T10:20:30.5+02:00", time.Date(2024, 3, 1, 8, 20, 30, 5e8, time.UTC)},
+		{"2024-03-01T10:20Z", time.Date(2024, 3, 1, 10, 20, 0, 0, time.UTC)},
+		{" 2024-03-01 ", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"2024-03", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"2024", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"yesterday", time.Time{}},
+		{"", time.Time{}},
+	}
+	for _, tt := range tests {
+		if got := parseLastmod(tt.in); !got.Equal(tt.want) {
+			t.Errorf("parseLastmod(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSeedFromSitemaps(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests []string
+		srvURL   string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r.URL.Path)
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nDisallow: /private\n\nSitemap: %s/private/sitemap.xml\n", srvURL)
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<sitemapindex><sitemap><loc>%s/pages.xml.gz</loc></sitemap></sitemapindex>`, srvURL)
+		case "/pages.xml.gz":
+			zw := gzip.NewWriter(w)
+			fmt.Fprintf(zw, `<urlset><url><loc>%[1]s/deep</loc></url><url><loc>https://other.example/x</loc></url></urlset>`, srvURL)
+			zw.Close()
+		case "/", "/deep":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<p>page</p>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	srvURL = srv.URL
+
+	base, _ := url.Parse(srv.URL + "/")
+	store := NewMemoryStorage()
+	c, err := NewCrawler(Config{BaseURL: base, MaxDepth: 0, Concurrency: 1, RespectRobots: true, Sitemaps: true, Storage: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Strings(requests)
+	// Sitemap из запрещенного robots.txt каталога не запрашивается, чужой хост не обходится
+	want := []string{"/", "/deep", "/pages.xml.gz", "/robots.txt", "/sitemap.xml"}
+	if fmt.Sprint(requests) != fmt.Sprint(want) {
+		t.Errorf("requests = %v, want %v", requests, want)
+	}
+}
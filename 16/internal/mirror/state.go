@@ -0,0 +1,211 @@
+package mirror
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Файл состояния обхода в OutputDir — по нему -resume продолжает прерванный обход.
+const stateFileName = ".site-mirror-state.json"
+
+const stateVersion = 1
+
+// Итог обработки URL
+const (
+	outcomeSaved   = "saved"
+	outcomeSkipped = "skipped"
+	outcomeFailed  = "failed"
+	// не изменился с прошлого запуска (304)
+	outcomeNotModified = "not-modified"
+	// редирект на URL, который скачивается отдельно (FinalURL)
+	outcomeRedirected = "redirected"
+)
+
+type urlOutcome struct {
+	// URL — адрес, как он был запрошен; ключ в outcomes — его канонический вид
+	URL         string   `json:"url,omitempty"`
+	Status      string   `json:"status"`
+	Error       string   `json:"error,omitempty"`
+	LocalPath   string   `json:"local_path,omitempty"`
+	FinalURL    string   `json:"final_url,omitempty"` // если был редирект
+	Redirects   []string `json:"redirects,omitempty"` // цепочка редиректов, см. FetchResult.Redirects
+	ContentType string   `json:"content_type,omitempty"`
+	HTTPStatus  int      `json:"http_status,omitempty"`
+	Size        int64    `json:"size,omitempty"`
+	SHA256      string   `json:"sha256,omitempty"`
+	DuplicateOf string   `json:"duplicate_of,omitempty"` // то же содержимое уже сохранено там, см. Config.Dedup
+	FetchMs     int64    `json:"fetch_ms,omitempty"`     // время ответа вместе с телом
+	Depth       int      `json:"depth,omitempty"`        // шагов по ссылкам от стартовой страницы
+	From        string   `json:"from,omitempty"`         // страница, где нашлась ссылка
+	Attempts    int      `json:"attempts,omitempty"`
+	// Convert — HTML/CSS сохранен как скачан, ссылки еще не переписаны
+	Convert bool `json:"convert,omitempty"`
+}
+
+// requestedURL — запрошенный URL; в состоянии старых версий его нет, тогда — ключ.
+func (o urlOutcome) requestedURL(key string) string {
+	if o.URL != "" {
+		return o.URL
+	}
+	return key
+}
+
+type savedTask struct {
+	URL       string       `json:"url"`
+	DepthLeft int          `json:"depth_left"`
+	Kind      ResourceKind `json:"kind"`
+	From      string       `json:"from,omitempty"`
+	Lastmod   string       `json:"lastmod,omitempty"`
+	Attempt   int          `json:"attempt,omitempty"`
+}
+
+type crawlState struct {
+	Version  int                   `json:"version"`
+	BaseURL  string                `json:"base_url"`
+	Visited  []string              `json:"visited"`
+	Pending  []savedTask           `json:"pending"`
+	Outcomes map[string]urlOutcome `json:"outcomes"`
+	// Blobs — индекс Config.Dedup: без него продолженный обход не узнал бы копии
+	// файлов, сохраненных до прерывания
+	Blobs map[string]string `json:"blobs,omitempty"`
+}
+
+func (c *Crawler) statePath() string {
+	return filepath.Join(c.cfg.OutputDir, stateFileName)
+}
+
+// saveState атомарно записывает снимок обхода: посещенные URL, незавершенные задачи и итоги.
+func (c *Crawler) saveState() error {
+	// Под c.mu, чтобы не поймать URL, уже отмеченный посещенным, но еще не добавленный в очередь
+	c.mu.Lock()
+	st := crawlState{
+		Version:  stateVersion,
+		BaseURL:  c.base.String(),
+		Visited:  make([]string, 0, len(c.visited)),
+		Pending:  []savedTask{},
+		Outcomes: make(map[string]urlOutcome, len(c.outcomes)),
+	}
+	for k := range c.visited {
+		st.Visited = append(st.Visited, k)
+	}
+	for k, o := range c.outcomes {
+		st.Outcomes[k] = o
+	}
+	for _, t := range c.frontier.snapshot() {
+		st.Pending = append(st.Pending, toSavedTask(t))
+	}
+	if len(c.blobs) > 0 {
+		st.Blobs = make(map[string]string, len(c.blobs))
+		for sum, name := range c.blobs {
+			st.Blobs[sum] = name
+		}
+	}
+	c.mu.Unlock()
+	sort.Strings(st.Visited)
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.statePath(), data, 0o644)
+}
+
+// loadState восстанавливает обход из файла состояния. Возвращает false, если файла нет.
+func (c *Crawler) loadState() (bool, error) {
+	data, err := os.ReadFile(c.statePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var st crawlState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return false, fmt.Errorf("файл состояния %s поврежден: %w", c.statePath(), err)
+	}
+	if st.Version != stateVersion {
+		return false, fmt.Errorf("неподдерживаемая версия файла состояния: %d", st.Version)
+	}
+	if st.BaseURL != c.base.String() {
+		return false, fmt.Errorf("файл состояния относится к %s, а не к %s", st.BaseURL, c.base)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, k := range st.Visited {
+		c.visited[k] = struct{}{}
+	}
+	for k, o := range st.Outcomes {
+		c.outcomes[k] = o
+		c.ownPath(k, o)
+	}
+	// Ссылаться можно только на копию, которая еще на месте
+	for sum, name := range st.Blobs {
+		if _, err := os.Stat(filepath.Join(c.cfg.OutputDir, filepath.FromSlash(name))); err == nil {
+			c.blobs[sum] = name
+		}
+	}
+	for _, s := range st.Pending {
+		t, err := fromSavedTask(s)
+		if err != nil {
+			return false, err
+		}
+		c.frontier.push(t)
+	}
+	return true, nil
+}
+
+func toSavedTask(t task) savedTask {
+	s := savedTask{URL: t.URL.String(), DepthLeft: t.DepthLeft, Kind: t.Kind, Attempt: t.Attempt}
+	if t.From != nil {
+		s.From = t.From.String()
+	}
+	if !t.Lastmod.IsZero() {
+		s.Lastmod = t.Lastmod.Format(time.RFC3339)
+	}
+	return s
+}
+
+func fromSavedTask(s savedTask) (task, error) {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return task{}, fmt.Errorf("некорректный URL в файле состояния: %w", err)
+	}
+	// NotBefore не сохраняем: после перезапуска повторяем сразу
+	t := task{URL: u, DepthLeft: s.DepthLeft, Kind: s.Kind, Lastmod: parseLastmod(s.Lastmod), Attempt: s.Attempt}
+	if s.From != "" {
+		if from, err := url.Parse(s.From); err == nil {
+			t.From = from
+		}
+	}
+	return t, nil
+}
+
+// writeFileAtomic пишет во временный файл рядом и переименовывает его,
+// чтобы прерывание не оставило наполовину записанный файл.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
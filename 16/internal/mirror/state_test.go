@@ -0,0 +1,229 @@
+package mirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestResume(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests = make(map[string]int)
+		cancel   context.CancelFunc
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		stop := cancel
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/a">a</a><a href="/b">b</a>`)
+		case "/a":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/">home</a>`)
+		case "/b":
+			// Первый запуск прерывается на этой странице
+			if stop != nil {
+				stop()
+				<-r.Context().Done()
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/a">a</a>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL + "/")
+	out := t.TempDir()
+	cfg := Config{BaseURL: base, OutputDir: out, MaxDepth: 2, Concurrency: 1, Resume: true}
+
+	ctx, cancelRun := context.WithCancel(context.Background())
+	defer cancelRun()
+	mu.Lock()
+	cancel = cancelRun
+	mu.Unlock()
+	c, err := NewCrawler(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("interrupted run returned %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(out, stateFileName)); err != nil {
+		t.Fatalf("state not saved: %v", err)
+	}
+
+	mu.Lock()
+	cancel = nil
+	clear(requests)
+	mu.Unlock()
+	c, err = NewCrawler(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Продолжение скачивает только прерванную страницу
+	if fmt.Sprint(requests) != "map[/b:1]" {
+		t.Errorf("resumed run requested %v, want only /b", requests)
+	}
+	var statuses []string
+	for _, e := range c.manifestEntries() {
+		statuses = append(statuses, strings.TrimPrefix(e.URL, srv.URL)+" "+e.Status)
+	}
+	if got := strings.Join(statuses, ", "); got != "/ saved, /a saved, /b saved" {
+		t.Errorf("outcomes: %s", got)
+	}
+	// Ссылки преобразованы и в страницах из первого запуска
+	host := strings.ReplaceAll(base.Host, ":", "_")
+	index, err := os.ReadFile(filepath.Join(out, host, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(index), srv.URL) || !strings.Contains(string(index), `href="b`) {
+		t.Errorf("links in index.html not converted: %s", index)
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+	cfg := Config{BaseURL: base, OutputDir: t.TempDir()}
+	c, err := NewCrawler(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	from, _ := url.Parse("https://example.com/")
+	for _, raw := range []string{"https://example.com/a", "https://example.com/img.png"} {
+		u, _ := url.Parse(raw)
+		kind := ResourcePage
+		if strings.HasSuffix(raw, ".png") {
+			kind = ResourceAsset
+		}
+		c.enqueue(task{URL: u, DepthLeft: 1, Kind: kind, From: from, Attempt: 2})
+	}
+	c.outcomes["https://example.com/"] = urlOutcome{Status: outcomeSaved, LocalPath: "example.com/index.html", Convert: true}
+	if err := c.saveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	restored, err := NewCrawler(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := restored.loadState(); !ok || err != nil {
+		t.Fatalf("loadState = %v, %v", ok, err)
+	}
+	if fmt.Sprint(restored.visited) != fmt.Sprint(c.visited) {
+		t.Errorf("visited = %v, want %v", restored.visited, c.visited)
+	}
+	if fmt.Sprint(restored.outcomes) != fmt.Sprint(c.outcomes) {
+		t.Errorf("outcomes = %v, want %v", restored.outcomes, c.outcomes)
+	}
+	var pending []string
+	for _, pt := range restored.frontier.snapshot() {
+		pending = append(pending, fmt.Sprintf("%s depth=%d kind=%d from=%s attempt=%d", pt.URL, pt.DepthLeft, pt.Kind, pt.From, pt.Attempt))
+	}
+	want := "https://example.com/a depth=1 kind=0 from=https://example.com/ attempt=2, https://example.com/img.png depth=1 kind=1 from=https://example.com/ attempt=2"
+	if got := strings.Join(pending, ", "); got != want {
+		t.Errorf("pending = %s", got)
+	}
+
+	// Состояние другого сайта не подхватывается
+	other, _ := url.Parse("https://other.example/")
+	c2, _ := NewCrawler(Config{BaseURL: other, OutputDir: cfg.OutputDir})
+	if _, err := c2.loadState(); err == nil {
+		t.Error("state of another site accepted")
+	}
+}
+
+func TestResumeKeepsDedupIndex(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		cancel context.CancelFunc
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		stop := cancel
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<img src="/img.png?v=1"><a href="/b">b</a><img src="/img.png?v=2">`)
+		case "/b":
+			// Прерываемся после первой копии картинки, до второй
+			if stop != nil {
+				stop()
+				<-r.Context().Done()
+				return
+			}
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<p>b</p>`)
+		case "/img.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "same bytes")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL + "/")
+	out := t.TempDir()
+	cfg := Config{BaseURL: base, OutputDir: out, MaxDepth: 1, Concurrency: 1, Resume: true, Dedup: true}
+
+	ctx, cancelRun := context.WithCancel(context.Background())
+	defer cancelRun()
+	mu.Lock()
+	cancel = cancelRun
+	mu.Unlock()
+	c, err := NewCrawler(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("interrupted run returned %v", err)
+	}
+
+	mu.Lock()
+	cancel = nil
+	mu.Unlock()
+	c, err = NewCrawler(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Копия из продолженного обхода узнана по индексу из состояния
+	host := strings.ReplaceAll(base.Host, ":", "_")
+	matches, _ := filepath.Glob(filepath.Join(out, host, "img_q_*.png"))
+	if len(matches) != 2 {
+		t.Fatalf("files %v, want two names for img.png", matches)
+	}
+	a, _ := os.Stat(matches[0])
+	b, _ := os.Stat(matches[1])
+	if !os.SameFile(a, b) {
+		t.Errorf("%s and %s are separate copies after resume", matches[0], matches[1])
+	}
+	v2, _ := url.Parse(srv.URL + "/img.png?v=2")
+	if o := c.outcomes[c.key(v2)]; o.DuplicateOf == "" {
+		t.Errorf("second copy not recorded as duplicate: %+v", o)
+	}
+}
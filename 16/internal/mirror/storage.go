@@ -0,0 +1,206 @@
+package mirror
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Storage — куда краулер складывает файлы зеркала. Пути относительные, через "/"
+// (как LocalPath в манифесте). Методы вызываются из нескольких воркеров сразу.
+type Storage interface {
+	// Put сохраняет файл из r; size — его длина в байтах
+	Put(name string, r io.Reader, size int64) error
+	// PutFile переносит в хранилище готовый временный файл; после вызова его нет
+	PutFile(name, tmpPath string) error
+	// Close завершает запись (архив дописывает оглавление)
+	Close() error
+}
+
+// ReadableStorage — хранилище, где сохраненный файл можно прочитать и перезаписать.
+// В таком хранилище HTML и CSS лежат как скачаны, пока convertLinks не переписал
+// в них ссылки; в остальные они попадают только после преобразования.
+type ReadableStorage interface {
+	Storage
+	// Open открывает сохраненный файл; для отсутствующего — ошибка fs.ErrNotExist
+	Open(name string) (io.ReadCloser, error)
+}
+
+// linker — хранилище, где файл можно сохранить жесткой ссылкой на уже записанный
+// (для одинакового содержимого по разным URL, см. Config.Dedup).
+type linker interface {
+	// Link делает name ссылкой на existing; ошибка — ссылку сделать не удалось
+	Link(existing, name string) error
+}
+
+// FSStorage — зеркало в каталоге на диске.
+type FSStorage struct {
+	dir string
+}
+
+func NewFSStorage(dir string) *FSStorage {
+	return &FSStorage{dir: dir}
+}
+
+func (s *FSStorage) path(name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", fmt.Errorf("недопустимый путь в зеркале: %q", name)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(name)), nil
+}
+
+// Put пишет во временный файл рядом и переименовывает: читатель не увидит файл недописанным.
+func (s *FSStorage) Put(name string, r io.Reader, size int64) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), filepath.Base(p)+".tmp*")
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(tmp, r)
+	if err == nil && n != size {
+		err = fmt.Errorf("%s: записано %d байт из %d", name, n, size)
+	}
+	if err == nil {
+		err = tmp.Chmod(0o644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+// PutFile переименовывает файл; временный каталог должен быть на той же ФС.
+func (s *FSStorage) PutFile(name, tmpPath string) error {
+	p, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, p)
+}
+
+// Link создает жесткую ссылку под временным именем и переименовывает ее на место.
+func (s *FSStorage) Link(existing, name string) error {
+	src, err := s.path(existing)
+	if err != nil {
+		return err
+	}
+	dst, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return err
+	}
+	// Временное имя берем у CreateTemp: os.Link не перезаписывает существующий файл
+	f, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".link*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	f.Close()
+	os.Remove(tmp)
+	if err := os.Link(src, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+func (s *FSStorage) Open(name string) (io.ReadCloser, error) {
+	p, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (s *FSStorage) Close() error { return nil }
+
+// MemoryStorage держит файлы в памяти — для тестов и небольших обходов.
+type MemoryStorage struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{files: make(map[string][]byte)}
+}
+
+func (s *MemoryStorage) Put(name string, r io.Reader, size int64) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	if int64(len(data)) != size {
+		return fmt.Errorf("%s: прочитано %d байт из %d", name, len(data), size)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[path.Clean(name)] = data
+	return nil
+}
+
+func (s *MemoryStorage) PutFile(name, tmpPath string) error {
+	data, err := os.ReadFile(tmpPath)
+	if err != nil {
+		return err
+	}
+	os.Remove(tmpPath)
+	return s.Put(name, bytes.NewReader(data), int64(len(data)))
+}
+
+func (s *MemoryStorage) Open(name string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.files[path.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *MemoryStorage) Close() error { return nil }
+
+// Names возвращает пути сохраненных файлов по порядку.
+func (s *MemoryStorage) Names() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.files))
+	for n := range s.files {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ReadFile возвращает содержимое сохраненного файла.
+func (s *MemoryStorage) ReadFile(name string) ([]byte, error) {
+	rc, err := s.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
@@ -0,0 +1,330 @@
+package mirror
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestCrawlToMemoryStorage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/docs/">docs</a><img src="/logo">`)
+		case "/docs/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/">home</a>`)
+		case "/logo":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "PNG")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL + "/")
+	store := NewMemoryStorage()
+	c, err := NewCrawler(Config{
+		BaseURL:     base,
+		MaxDepth:    2,
+		Concurrency: 2,
+		Incremental: true,
+		Resume:      true,
+		Storage:     store,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	host := strings.ReplaceAll(base.Host, ":", "_")
+	want := []string{host + "/docs/index.html", host + "/index.html", host + "/logo.png"}
+	if got := store.Names(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("stored %v, want %v", got, want)
+	}
+	index, _ := store.ReadFile(host + "/index.html")
+	if !strings.Contains(string(index), `href="docs/index.html"`) || !strings.Contains(string(index), `src="logo.png"`) {
+		t.Errorf("links not converted: %s", index)
+	}
+}
+
+func TestArchiveStorage(t *testing.T) {
+	files := map[string]string{"a/index.html": "<p>hi</p>", "a/img.png": "PNG"}
+	for _, format := range []string{"tar", "zip"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			s := NewTarStorage(&buf)
+			if format == "zip" {
+				s = NewZipStorage(&buf)
+			}
+			for _, name := range []string{"a/index.html", "a/img.png"} {
+				if err := s.Put(name, strings.NewReader(files[name]), int64(len(files[name]))); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Put("a/img.png", strings.NewReader("x"), 1); err == nil {
+				t.Error("duplicate entry accepted")
+			}
+			if err := s.Put("../evil", strings.NewReader("x"), 1); err == nil {
+				t.Error("path outside archive accepted")
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			_, got := readArchive(t, format, buf.Bytes())
+			if fmt.Sprint(got) != fmt.Sprint(files) {
+				t.Errorf("archive contains %v, want %v", got, files)
+			}
+		})
+	}
+}
+
+// readArchive возвращает имена записей архива по порядку и их содержимое;
+// у ссылки tar содержимое — "-> " и имя файла, на который она ссылается.
+func readArchive(t *testing.T, format string, data []byte) ([]string, map[string]string) {
+	t.Helper()
+	var names []string
+	got := make(map[string]string)
+	if format == "tar" {
+		tr := tar.NewReader(bytes.NewReader(data))
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(tr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names = append(names, h.Name)
+			got[h.Name] = string(body)
+			if h.Typeflag == tar.TypeLink {
+				got[h.Name] = "-> " + h.Linkname
+			}
+		}
+		return names, got
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		names = append(names, f.Name)
+		got[f.Name] = string(body)
+	}
+	return names, got
+}
+
+func TestDedup(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<img src="/img.png?v=1"><img src="/img.png?v=2"><img src="/other.png">`)
+		case "/img.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "same bytes")
+		case "/other.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "other bytes")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	base, _ := url.Parse(srv.URL + "/")
+	host := strings.ReplaceAll(base.Host, ":", "_")
+
+	crawl := func(t *testing.T, cfg Config) {
+		cfg.BaseURL, cfg.MaxDepth, cfg.Concurrency, cfg.Dedup = base, 1, 1, true
+		c, err := NewCrawler(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Run(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if r := buildReport(base.String(), c.manifestEntries()); r.Duplicates != 1 || r.DedupSaved != int64(len("same bytes")) {
+			t.Errorf("duplicates = %d, saved = %d", r.Duplicates, r.DedupSaved)
+		}
+	}
+
+	t.Run("memory rewrites references", func(t *testing.T) {
+		store := NewMemoryStorage()
+		crawl(t, Config{Storage: store})
+		var images []string
+		for _, n := range store.Names() {
+			if strings.HasSuffix(n, ".png") {
+				images = append(images, n)
+			}
+		}
+		if len(images) != 2 {
+			t.Fatalf("stored images %v, want one copy of img.png and other.png", images)
+		}
+		index, _ := store.ReadFile(host + "/index.html")
+		first := strings.TrimPrefix(images[0], host+"/")
+		if strings.Count(string(index), `src="`+first+`"`) != 2 {
+			t.Errorf("duplicates do not point at %s: %s", first, index)
+		}
+	})
+
+	t.Run("directory hardlinks", func(t *testing.T) {
+		dir := t.TempDir()
+		crawl(t, Config{OutputDir: dir})
+		matches, _ := filepath.Glob(filepath.Join(dir, host, "img_q_*.png"))
+		if len(matches) != 2 {
+			t.Fatalf("files %v, want two names for img.png", matches)
+		}
+		a, _ := os.Stat(matches[0])
+		b, _ := os.Stat(matches[1])
+		if !os.SameFile(a, b) {
+			t.Errorf("%s and %s are separate copies", matches[0], matches[1])
+		}
+	})
+}
+
+func TestArchiveStorageRetryAfterFailedPut(t *testing.T) {
+	for _, format := range []string{"tar", "zip"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			s := NewTarStorage(&buf)
+			if format == "zip" {
+				s = NewZipStorage(&buf)
+			}
+			broken := io.MultiReader(strings.NewReader("par"), iotest.ErrReader(errors.New("read failed")))
+			if err := s.Put("a/index.html", broken, 7); err == nil {
+				t.Fatal("failed read reported as success")
+			}
+			if err := s.Put("a/short.html", strings.NewReader("abc"), 7); err == nil {
+				t.Fatal("short body reported as success")
+			}
+			if err := s.Put("a/short.html", io.MultiReader(strings.NewReader("abc")), 7); err == nil {
+				t.Fatal("short stream reported as success")
+			}
+			// Неудавшаяся запись не занимает имя и не портит архив: следующие записи проходят
+			if err := s.Put("a/index.html", io.MultiReader(strings.NewReader("<p>ok</p>")), 9); err != nil {
+				t.Fatalf("retry after failed Put: %v", err)
+			}
+			if err := s.Put("a/img.png", strings.NewReader("PNG"), 3); err != nil {
+				t.Fatal(err)
+			}
+			if format == "tar" {
+				if err := s.Link("a/img.png", "a/copy.png"); err != nil {
+					t.Fatalf("Link after failed Put: %v", err)
+				}
+			}
+			if err := s.Put("a/index.html", strings.NewReader("x"), 1); err == nil {
+				t.Error("duplicate entry accepted after successful retry")
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// В архиве только удавшиеся записи, каждая один раз и целиком
+			names, got := readArchive(t, format, buf.Bytes())
+			want := map[string]string{"a/index.html": "<p>ok</p>", "a/img.png": "PNG"}
+			wantNames := "[a/index.html a/img.png]"
+			if format == "tar" {
+				want["a/copy.png"] = "-> a/img.png"
+				wantNames = "[a/index.html a/img.png a/copy.png]"
+			}
+			if fmt.Sprint(names) != wantNames || fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("archive entries %v with %v, want %s with %v", names, got, wantNames, want)
+			}
+		})
+	}
+}
+
+func TestCrawlToArchiveStagesOnDisk(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/docs/">docs</a><link rel="stylesheet" href="/s.css">`)
+		case "/docs/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<a href="/">home</a>`)
+		case "/s.css":
+			w.Header().Set("Content-Type", "text/css")
+			fmt.Fprint(w, `body { background: url(/bg.png) }`)
+		case "/bg.png":
+			w.Header().Set("Content-Type", "image/png")
+			fmt.Fprint(w, "PNG")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL + "/")
+	var buf bytes.Buffer
+	c, err := NewCrawler(Config{BaseURL: base, MaxDepth: 2, Concurrency: 2, Storage: NewTarStorage(&buf)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Страницы ждали преобразования во временном каталоге, и он удален после обхода
+	fsStaging, ok := c.staging.(*FSStorage)
+	if !ok {
+		t.Fatalf("staging is %T, want *FSStorage", c.staging)
+	}
+	if _, err := os.Stat(fsStaging.dir); !os.IsNotExist(err) {
+		t.Errorf("staging dir %s left behind: %v", fsStaging.dir, err)
+	}
+
+	host := strings.ReplaceAll(base.Host, ":", "_")
+	got := make(map[string]string)
+	tr := tar.NewReader(&buf)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		got[strings.TrimPrefix(h.Name, host+"/")] = string(data)
+	}
+	if len(got) != 4 {
+		t.Errorf("archive entries %v", got)
+	}
+	if !strings.Contains(got["index.html"], `href="docs/index.html"`) || !strings.Contains(got["s.css"], `url(bg.png)`) {
+		t.Errorf("links not converted: %q, %q", got["index.html"], got["s.css"])
+	}
+}
@@ -14,6 +14,71 @@ type Config struct {
 	UserAgent      string
 	RespectRobots  bool
 	SameHostOnly   bool
+	Resume         bool  // продолжить обход по файлу состояния в OutputDir
+	Incremental    bool  // условные запросы по ETag/Last-Modified с прошлого запуска
+	Sitemaps       bool  // брать стартовые URL из sitemap.xml и Sitemap: в robots.txt
+	MaxFileSize    int64 // предельный размер файла в байтах, 0 — без ограничения
+
+	// Вежливость по отношению к каждому хосту; 0 — без ограничения.
+	// Crawl-delay из robots.txt учитывается, если он строже HostRPS.
+	HostConcurrency int     // одновременных запросов к одному хосту
+	HostRPS         float64 // запросов в секунду к одному хосту
+
+	Retry RetryPolicy
+
+	// Canonical — правила приведения URL к одному виду; нулевое значение — только
+	// нормализация кодирования и точек в пути
+	Canonical Canonicalization
+
+	// AllowedDomains — хосты, страницы с которых обходятся ("example.com", "*.example.com" —
+	// домен и все поддомены); если задан, заменяет SameHostOnly. Хост BaseURL разрешен всегда.
+	AllowedDomains []string
+	// PageRequisites — ассеты, нужные сохраненным страницам, скачиваются с любого хоста,
+	// но их ссылки дальше не обходятся
+	PageRequisites bool
+
+	// Область обхода: правила для URL (см. urlFilter) и типы содержимого
+	Include   []string
+	Exclude   []string
+	AllowMIME []string
+	DenyMIME  []string
+
+	// Бюджеты обхода; 0 — без ограничения
+	MaxPages    int
+	MaxBytes    int64
+	MaxDuration time.Duration
+
+	// WARC: если WARCPrefix задан, все HTTP-обмены пишутся в файлы
+	// WARCPrefix-<время>-NNNNN.warc.gz сегментами не больше WARCMaxSize (0 — 1 ГБ).
+	// WARCOnly — только архив, файлы зеркала не сохраняются.
+	WARCPrefix  string
+	WARCMaxSize int64
+	WARCOnly    bool
+
+	// Manifest — файл JSON lines с итогом по каждому URL; пусто — не писать.
+	// Report — файл со сводкой: число URL по статусам, самые медленные и большие ресурсы
+	Manifest string
+	Report   string
+
+	// Progress — строка прогресса в выводе log (для терминала)
+	Progress bool
+	// MetricsAddr — адрес HTTP-сервера с /metrics в формате Prometheus; пусто — не запускать
+	MetricsAddr string
+
+	// CheckLinks — режим проверки ссылок: страницы обходятся как обычно, но ничего не
+	// сохраняется (ни файлы, ни состояние), а ссылки за пределами обхода, в том числе
+	// на другие сайты, только проверяются HEAD-запросом. Итог — Crawler.BrokenLinks
+	CheckLinks bool
+
+	// Dedup — файл с уже сохраненным содержимым (картинка под разными query) не
+	// сохраняется заново: в каталоге и tar это жесткая ссылка, в остальных хранилищах
+	// ссылки в страницах ведут на первую копию. HTML и CSS не сравниваются
+	Dedup bool
+
+	// Storage — куда сохранять файлы зеркала; nil — каталог OutputDir. С другим
+	// хранилищем состояние и кэш валидаторов не ведутся (Resume и Incremental выключены),
+	// а OutputDir не используется
+	Storage Storage
 }
 
 type task struct {
@@ -21,6 +86,10 @@ type task struct {
 	DepthLeft int
 	Kind      ResourceKind // Page or Asset
 	From      *url.URL     // откуда обнаружена (для диагностики)
+	Lastmod   time.Time    // <lastmod> из sitemap, если URL оттуда
+	Attempt   int          // сколько попыток уже сделано
+	NotBefore time.Time    // повтор не раньше этого момента
+	CheckOnly bool         // только проверить доступность (режим CheckLinks)
 }
 
 type ResourceKind int
@@ -0,0 +1,346 @@
+package mirror
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Размер сегмента WARC по умолчанию
+const defaultWARCMaxSize = 1 << 30
+
+// warcWriter пишет записи WARC 1.1. Каждая запись — отдельный gzip-член, так что
+// файл можно читать с любой записи; когда сегмент перерастает maxSize, начинается
+// следующий файл prefix-<время старта>-NNNNN.warc.gz со своей записью warcinfo.
+type warcWriter struct {
+	mu      sync.Mutex
+	prefix  string
+	maxSize int64
+	info    []byte // тело warcinfo (application/warc-fields)
+	started string
+	seq     int
+
+	f      *os.File
+	size   int64
+	infoID string
+	err    error // первая ошибка записи; возвращается из close
+}
+
+func newWARCWriter(prefix string, maxSize int64, info []byte) *warcWriter {
+	if maxSize <= 0 {
+		maxSize = defaultWARCMaxSize
+	}
+	return &warcWriter{
+		prefix:  prefix,
+		maxSize: maxSize,
+		info:    info,
+		started: time.Now().UTC().Format("20060102150405"),
+	}
+}
+
+// warcInfoFields собирает тело warcinfo из пар "имя: значение".
+func warcInfoFields(fields ...string) []byte {
+	var b bytes.Buffer
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i+1] != "" {
+			fmt.Fprintf(&b, "%s: %s\r\n", fields[i], fields[i+1])
+		}
+	}
+	return b.Bytes()
+}
+
+type warcRecord struct {
+	header [][2]string // порядок полей сохраняется; Content-Length добавляется при записи
+	block  io.Reader
+	length int64
+}
+
+// writeTransaction пишет записи одного обмена подряд, не перемежая их с другими.
+func (w *warcWriter) writeTransaction(recs ...warcRecord) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.writeLocked(recs)
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	return err
+}
+
+func (w *warcWriter) writeLocked(recs []warcRecord) error {
+	if w.f == nil {
+		if err := w.openSegment(); err != nil {
+			return err
+		}
+	}
+	for _, rec := range recs {
+		rec.header = append(rec.header, [2]string{"WARC-Warcinfo-ID", w.infoID})
+		if err := w.writeRecord(rec); err != nil {
+			return err
+		}
+	}
+	// Сегмент закрываем после транзакции, чтобы запрос и ответ не разъехались по файлам
+	if w.size >= w.maxSize {
+		return w.closeSegment()
+	}
+	return nil
+}
+
+func (w *warcWriter) openSegment() error {
+	name := fmt.Sprintf("%s-%s-%05d.warc.gz", w.prefix, w.started, w.seq)
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return err
+	}
+	w.seq++
+	w.f, w.size = f, 0
+	w.infoID = newRecordID()
+	return w.writeRecord(warcRecord{
+		header: [][2]string{
+			{"WARC-Type", "warcinfo"},
+			{"WARC-Record-ID", w.infoID},
+			{"WARC-Date", warcDate(time.Now())},
+			{"WARC-Filename", filepath.Base(name)},
+			{"Content-Type", "application/warc-fields"},
+		},
+		block:  bytes.NewReader(w.info),
+		length: int64(len(w.info)),
+	})
+}
+
+func (w *warcWriter) writeRecord(rec warcRecord) error {
+	cw := &countingWriter{w: w.f}
+	gz := gzip.NewWriter(cw)
+	bw := bufio.NewWriter(gz)
+	bw.WriteString("WARC/1.1\r\n")
+	for _, h := range rec.header {
+		fmt.Fprintf(bw, "%s: %s\r\n", h[0], h[1])
+	}
+	fmt.Fprintf(bw, "Content-Length: %d\r\n\r\n", rec.length)
+	if _, err := io.Copy(bw, rec.block); err != nil {
+		return err
+	}
+	bw.WriteString("\r\n\r\n")
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	w.size += cw.n
+	return nil
+}
+
+func (w *warcWriter) closeSegment() error {
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Close()
+	w.f = nil
+	return err
+}
+
+// close закрывает текущий сегмент и возвращает первую ошибку записи, если она была.
+func (w *warcWriter) close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.closeSegment(); err != nil && w.err == nil {
+		w.err = err
+	}
+	return w.err
+}
+
+// warcTransport записывает в WARC каждый HTTP-обмен, включая редиректы, robots.txt
+// и sitemap. Тело ответа по мере чтения копируется во временный файл; записи
+// request/response/metadata появляются, когда тело дочитано до конца. Недочитанные
+// тела (пропущенные по размеру или типу, оборванные, GET проверки ссылок, закрытый
+// сразу после заголовков) в архив не попадают. Ответ на HEAD тела не имеет
+// и архивируется одними заголовками.
+type warcTransport struct {
+	next     http.RoundTripper
+	w        *warcWriter
+	spoolDir string
+}
+
+func (t *warcTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	spool, err := os.CreateTemp(t.spoolDir, "warc-*")
+	if err != nil {
+		log.Printf("WARC: %s не будет записан: %v", req.URL, err)
+		return resp, nil
+	}
+
+	var head bytes.Buffer
+	fmt.Fprintf(&head, "HTTP/%d.%d %s\r\n", resp.ProtoMajor, resp.ProtoMinor, resp.Status)
+	resp.Header.Write(&head)
+	head.WriteString("\r\n")
+
+	body := &warcBody{
+		rc:       resp.Body,
+		t:        t,
+		req:      req,
+		start:    start,
+		respHead: head.Bytes(),
+		spool:    spool,
+		payload:  sha1.New(),
+		block:    sha1.New(),
+		// Читать у HEAD нечего: обмен завершен, как только получены заголовки
+		eof: req.Method == http.MethodHead,
+	}
+	body.block.Write(body.respHead)
+	resp.Body = body
+	return resp, nil
+}
+
+type warcBody struct {
+	rc       io.ReadCloser
+	t        *warcTransport
+	req      *http.Request
+	start    time.Time
+	respHead []byte
+
+	spool   *os.File
+	size    int64
+	payload hash.Hash
+	block   hash.Hash
+	eof     bool
+	failed  bool
+}
+
+func (b *warcBody) Read(p []byte) (int, error) {
+	n, err := b.rc.Read(p)
+	if n > 0 && !b.failed {
+		if _, werr := b.spool.Write(p[:n]); werr != nil {
+			b.failed = true
+		}
+		b.payload.Write(p[:n])
+		b.block.Write(p[:n])
+		b.size += int64(n)
+	}
+	if err == io.EOF {
+		b.eof = true
+	}
+	return n, err
+}
+
+func (b *warcBody) Close() error {
+	err := b.rc.Close()
+	defer os.Remove(b.spool.Name())
+	defer b.spool.Close()
+	if !b.eof || b.failed {
+		return err
+	}
+	if werr := b.archive(); werr != nil {
+		log.Printf("WARC: ошибка записи %s: %v", b.req.URL, werr)
+	}
+	return err
+}
+
+func (b *warcBody) archive() error {
+	if _, err := b.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	reqBlock := formatRequest(b.req)
+	target := b.req.URL.String()
+	date := warcDate(b.start)
+	respID, reqID := newRecordID(), newRecordID()
+	fields := warcInfoFields("fetchTimeMs", strconv.FormatInt(time.Since(b.start).Milliseconds(), 10))
+
+	return b.t.w.writeTransaction(
+		warcRecord{
+			header: [][2]string{
+				{"WARC-Type", "response"},
+				{"WARC-Record-ID", respID},
+				{"WARC-Date", date},
+				{"WARC-Target-URI", target},
+				{"Content-Type", "application/http;msgtype=response"},
+				{"WARC-Block-Digest", sha1Digest(b.block)},
+				{"WARC-Payload-Digest", sha1Digest(b.payload)},
+			},
+			block:  io.MultiReader(bytes.NewReader(b.respHead), b.spool),
+			length: int64(len(b.respHead)) + b.size,
+		},
+		warcRecord{
+			header: [][2]string{
+				{"WARC-Type", "request"},
+				{"WARC-Record-ID", reqID},
+				{"WARC-Date", date},
+				{"WARC-Target-URI", target},
+				{"WARC-Concurrent-To", respID},
+				{"Content-Type", "application/http;msgtype=request"},
+			},
+			block:  bytes.NewReader(reqBlock),
+			length: int64(len(reqBlock)),
+		},
+		warcRecord{
+			header: [][2]string{
+				{"WARC-Type", "metadata"},
+				{"WARC-Record-ID", newRecordID()},
+				{"WARC-Date", date},
+				{"WARC-Target-URI", target},
+				{"WARC-Refers-To", respID},
+				{"Content-Type", "application/warc-fields"},
+			},
+			block:  bytes.NewReader(fields),
+			length: int64(len(fields)),
+		},
+	)
+}
+
+// formatRequest восстанавливает запрос в том виде, в каком его отправил транспорт.
+func formatRequest(req *http.Request) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", req.Method, req.URL.RequestURI())
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fmt.Fprintf(&b, "Host: %s\r\n", host)
+	req.Header.Write(&b)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
+
+func sha1Digest(h hash.Hash) string {
+	return "sha1:" + base32.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func warcDate(t time.Time) string {
+	return t.UTC().Format("2006-01-02T15:04:05Z")
+}
+
+// newRecordID — UUID версии 4 в форме, которую требует WARC-Record-ID.
+func newRecordID() string {
+	var u [16]byte
+	rand.Read(u[:])
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", u[0:4], u[4:6], u[6:8], u[8:10], u[10:])
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
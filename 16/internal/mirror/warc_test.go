@@ -0,0 +1,224 @@
+package mirror
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type parsedWARCRecord struct {
+	header textproto.MIMEHeader
+	block  []byte
+}
+
+// readWARC разбирает сегмент и проверяет, что каждая запись — отдельный gzip-член,
+// а Content-Length совпадает с длиной блока.
+func readWARC(t *testing.T, path string) []parsedWARCRecord {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	// bufio.Reader — io.ByteReader: gzip не читает дальше конца своего члена
+	src := bufio.NewReader(f)
+	zr, err := gzip.NewReader(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recs []parsedWARCRecord
+	for {
+		zr.Multistream(false)
+		member, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		br := bufio.NewReader(bytes.NewReader(member))
+		if version, _ := br.ReadString('\n'); version != "WARC/1.1\r\n" {
+			t.Fatalf("%s: record starts with %q", path, version)
+		}
+		header, err := textproto.NewReader(br).ReadMIMEHeader()
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		n, err := strconv.Atoi(header.Get("Content-Length"))
+		if err != nil {
+			t.Fatalf("%s: Content-Length %q", path, header.Get("Content-Length"))
+		}
+		block := make([]byte, n)
+		if _, err := io.ReadFull(br, block); err != nil {
+			t.Fatalf("%s: block shorter than Content-Length %d", path, n)
+		}
+		if rest, _ := io.ReadAll(br); string(rest) != "\r\n\r\n" {
+			t.Fatalf("%s: record trailer %q, want CRLF CRLF and one record per gzip member", path, rest)
+		}
+		recs = append(recs, parsedWARCRecord{header: header, block: block})
+
+		if err := zr.Reset(src); err == io.EOF {
+			return recs
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func warcSegments(t *testing.T, prefix string) []string {
+	t.Helper()
+	files, err := filepath.Glob(prefix + "-*.warc.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func digestOf(b []byte) string {
+	sum := sha1.Sum(b)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestWARCWriterSegments(t *testing.T) {
+	prefix := filepath.Join(t.TempDir(), "crawl")
+	info := warcInfoFields("software", "site-mirror/1.0", "empty", "", "isPartOf", "https://example.com/")
+	// Сегмент закрывается, как только перерастет 1 байт: каждая транзакция — в своем файле
+	w := newWARCWriter(prefix, 1, info)
+	for i := 0; i < 3; i++ {
+		body := fmt.Sprintf("record %d", i)
+		err := w.writeTransaction(
+			warcRecord{header: [][2]string{{"WARC-Type", "resource"}, {"WARC-Record-ID", newRecordID()}}, block: strings.NewReader(body), length: int64(len(body))},
+			warcRecord{header: [][2]string{{"WARC-Type", "metadata"}, {"WARC-Record-ID", newRecordID()}}, block: strings.NewReader(""), length: 0},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segs := warcSegments(t, prefix)
+	if len(segs) != 3 {
+		t.Fatalf("%d segments, want 3: %v", len(segs), segs)
+	}
+	for i, seg := range segs {
+		if !strings.HasSuffix(seg, fmt.Sprintf("-%05d.warc.gz", i)) {
+			t.Errorf("segment %d named %s", i, seg)
+		}
+		recs := readWARC(t, seg)
+		if len(recs) != 3 {
+			t.Fatalf("%s: %d records, want warcinfo + transaction", seg, len(recs))
+		}
+		wi := recs[0]
+		if wi.header.Get("WARC-Type") != "warcinfo" || wi.header.Get("WARC-Filename") != filepath.Base(seg) ||
+			wi.header.Get("Content-Type") != "application/warc-fields" {
+			t.Errorf("%s: warcinfo header %v", seg, wi.header)
+		}
+		if string(wi.block) != "software: site-mirror/1.0\r\nisPartOf: https://example.com/\r\n" {
+			t.Errorf("%s: warcinfo body %q", seg, wi.block)
+		}
+		if _, err := time.Parse("2006-01-02T15:04:05Z", wi.header.Get("WARC-Date")); err != nil {
+			t.Errorf("%s: WARC-Date %q", seg, wi.header.Get("WARC-Date"))
+		}
+		// Запись транзакции ссылается на warcinfo своего сегмента
+		for _, rec := range recs[1:] {
+			if rec.header.Get("WARC-Warcinfo-ID") != wi.header.Get("WARC-Record-ID") {
+				t.Errorf("%s: WARC-Warcinfo-ID %q, want %q", seg, rec.header.Get("WARC-Warcinfo-ID"), wi.header.Get("WARC-Record-ID"))
+			}
+		}
+		if got := string(recs[1].block); got != fmt.Sprintf("record %d", i) {
+			t.Errorf("%s: block %q", seg, got)
+		}
+	}
+}
+
+func TestWARCTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", "5")
+		fmt.Fprint(w, "hello")
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	prefix := filepath.Join(dir, "crawl")
+	ww := newWARCWriter(prefix, 0, warcInfoFields("software", "site-mirror/1.0"))
+	hc := NewHttpClient(5*time.Second, "site-mirror-test")
+	hc.archiveTo(ww, dir)
+
+	if _, err := hc.Get(context.Background(), srv.URL+"/page", GetOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := hc.Check(context.Background(), srv.URL+"/head"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ww.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	segs := warcSegments(t, prefix)
+	if len(segs) != 1 {
+		t.Fatalf("%d segments, want 1", len(segs))
+	}
+	recs := readWARC(t, segs[0])
+	var types []string
+	for _, r := range recs {
+		types = append(types, r.header.Get("WARC-Type"))
+	}
+	want := "[warcinfo response request metadata response request metadata]"
+	if fmt.Sprint(types) != want {
+		t.Fatalf("record types %v, want %s", types, want)
+	}
+
+	get, head := recs[1], recs[4]
+	if get.header.Get("WARC-Target-URI") != srv.URL+"/page" || head.header.Get("WARC-Target-URI") != srv.URL+"/head" {
+		t.Errorf("target URIs %q, %q", get.header.Get("WARC-Target-URI"), head.header.Get("WARC-Target-URI"))
+	}
+	if ct := get.header.Get("Content-Type"); ct != "application/http;msgtype=response" {
+		t.Errorf("response Content-Type %q", ct)
+	}
+	// Блок — ответ целиком, как его отдал сервер; дайджесты считаются по блоку и телу
+	if !bytes.HasPrefix(get.block, []byte("HTTP/1.1 200 OK\r\n")) || !bytes.HasSuffix(get.block, []byte("\r\n\r\nhello")) {
+		t.Errorf("response block %q", get.block)
+	}
+	if got := get.header.Get("WARC-Block-Digest"); got != digestOf(get.block) {
+		t.Errorf("WARC-Block-Digest %s, want %s", got, digestOf(get.block))
+	}
+	if got := get.header.Get("WARC-Payload-Digest"); got != digestOf([]byte("hello")) {
+		t.Errorf("WARC-Payload-Digest %s, want %s", got, digestOf([]byte("hello")))
+	}
+
+	req, meta := recs[2], recs[3]
+	if req.header.Get("WARC-Concurrent-To") != get.header.Get("WARC-Record-ID") || meta.header.Get("WARC-Refers-To") != get.header.Get("WARC-Record-ID") {
+		t.Error("request/metadata records do not point to their response")
+	}
+	if !bytes.HasPrefix(req.block, []byte("GET /page HTTP/1.1\r\nHost: ")) || !bytes.Contains(req.block, []byte("User-Agent: site-mirror-test\r\n")) {
+		t.Errorf("request block %q", req.block)
+	}
+	if !bytes.HasPrefix(meta.block, []byte("fetchTimeMs: ")) {
+		t.Errorf("metadata block %q", meta.block)
+	}
+
+	// HEAD из проверки ссылок архивируется одними заголовками
+	if !bytes.HasSuffix(head.block, []byte("\r\n\r\n")) || bytes.Contains(head.block, []byte("hello")) {
+		t.Errorf("HEAD response block %q", head.block)
+	}
+	if !bytes.HasPrefix(recs[5].block, []byte("HEAD /head HTTP/1.1\r\n")) {
+		t.Errorf("HEAD request block %q", recs[5].block)
+	}
+	if got := head.header.Get("WARC-Payload-Digest"); got != digestOf(nil) {
+		t.Errorf("HEAD payload digest %s, want digest of empty body", got)
+	}
+}